@@ -60,3 +60,32 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Name the followers verify the certificate of the leader for, the service DNS name by default
+*/}}
+{{- define "kubernetes-cost-report.tlsServerName" -}}
+{{- default (printf "%s.%s.svc" (include "kubernetes-cost-report.fullname" .) .Release.Namespace) .Values.tls.serverName }}
+{{- end }}
+
+{{/*
+Exporter JSON config, with the paths of the mounted secrets
+*/}}
+{{- define "kubernetes-cost-report.config" -}}
+{{- $config := deepCopy .Values.config }}
+{{- with .Values.refreshToken.existingSecret }}
+{{- $_ := set $config "refreshTokenFile" (printf "/var/run/secrets/cost-report/refresh-token/%s" $.Values.refreshToken.key) }}
+{{- end }}
+{{- with .Values.tls.existingSecret }}
+{{- $_ := set $config "tlsCertFile" "/var/run/secrets/cost-report/tls/tls.crt" }}
+{{- $_ := set $config "tlsKeyFile" "/var/run/secrets/cost-report/tls/tls.key" }}
+{{- $_ := set $config "leaderTlsServerName" (include "kubernetes-cost-report.tlsServerName" $) }}
+{{- with $.Values.tls.caKey }}
+{{- $_ := set $config "leaderTlsCAFile" (printf "/var/run/secrets/cost-report/tls/%s" .) }}
+{{- end }}
+{{- with $.Values.tls.clientCAKey }}
+{{- $_ := set $config "tlsClientCAFile" (printf "/var/run/secrets/cost-report/tls/%s" .) }}
+{{- end }}
+{{- end }}
+{{- toJson $config }}
+{{- end }}
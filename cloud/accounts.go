@@ -0,0 +1,181 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// AccountID label.
+const AccountID = "account_id"
+
+// Account is an AWS account the in-use instances and spot prices are collected from.
+type Account struct {
+	// RoleARN is the role assumed in the account, the exporter credentials are used when empty.
+	RoleARN string `json:"roleArn"`
+	// ExternalID is the external ID required by the trust policy of the role.
+	ExternalID string `json:"externalId"`
+}
+
+// accountData holds the data collected from an account.
+type accountData struct {
+	ID string
+	// First is set on the first account of the config, the cluster one.
+	First           bool
+	Spot            []Spot
+	SpotStats       []SpotStat
+	Instances       []Instance
+	PlacementScores []SpotPlacementScore
+}
+
+// collector returns the name the health of the account is recorded with.
+func (a Account) collector() string {
+	if a.RoleARN == "" {
+		return collectorAccounts + "/default"
+	}
+
+	return collectorAccounts + "/" + a.RoleARN
+}
+
+// session returns a session with the credentials of the account.
+func (a Account) session() (*session.Session, error) {
+	ses, err := newSession(aws.NewConfig().WithRegion("eu-west-1"))
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	if a.RoleARN == "" {
+		return ses, nil
+	}
+
+	creds := stscreds.NewCredentials(ses, a.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		if a.ExternalID != "" {
+			p.ExternalID = aws.String(a.ExternalID)
+		}
+	})
+
+	return ses.Copy(aws.NewConfig().WithCredentials(creds)), nil
+}
+
+// collectAccountData collects the in-use instances, spot prices and placement scores with the EC2 client of the account.
+// The kinds of data failing are skipped with a partial error, unless they all fail.
+func collectAccountData(ctx context.Context, svc ec2iface.EC2API, id string, cfg Config) (accountData, error) {
+	data := accountData{ID: id}
+	errs := []error{}
+	kinds := 2
+	var err error
+
+	data.Spot, data.SpotStats, err = spotMetric(ctx, svc, cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	data.Instances, err = runningInstances(ctx, svc, cfg.tagKeys())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(cfg.PlacementScoreInstanceTypes) > 0 {
+		kinds++
+		data.PlacementScores, err = spotPlacementScores(ctx, svc, cfg.PlacementScoreInstanceTypes, cfg.PlacementScoreTargetCapacity)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == kinds {
+		return accountData{ID: id}, errors.Join(errs...)
+	}
+
+	for i := range data.Spot {
+		data.Spot[i].AccountID = id
+	}
+	for i := range data.SpotStats {
+		data.SpotStats[i].AccountID = id
+	}
+	for i := range data.Instances {
+		data.Instances[i].AccountID = id
+	}
+	for i := range data.PlacementScores {
+		data.PlacementScores[i].AccountID = id
+	}
+
+	return data, joinPartial(collectorAccounts, errs)
+}
+
+// callerAccount returns the ID of the account of the session credentials.
+func callerAccount(ctx context.Context, ses *session.Session) (string, error) {
+	identity, err := sts.New(ses).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(identity.Account), nil
+}
+
+// collectAccount collects the data of the account identified with the caller identity of its credentials.
+func collectAccount(ctx context.Context, account Account, cfg Config) (accountData, error) {
+	start := time.Now()
+	ses, err := account.session()
+	if err != nil {
+		return accountData{}, err
+	}
+	id, err := callerAccount(ctx, ses)
+	if err != nil {
+		return accountData{}, fmt.Errorf("getCallerIdentity %s: %w", account.RoleARN, err)
+	}
+	data, err := collectAccountData(ctx, ec2.New(ses), id, cfg)
+	if err != nil {
+		return data, fmt.Errorf("account %s: %w", id, err)
+	}
+	slog.DebugContext(ctx, "Collected the account", "account", id, "region", "eu-west-1", "spot", len(data.Spot),
+		"instances", len(data.Instances), "duration", time.Since(start))
+
+	return data, nil
+}
+
+// collectAccounts collects the data of every account of the config in parallel, in the config order.
+// The accounts failing are skipped with a partial error, the accounts collected partially are kept, and their health
+// is recorded per account.
+func collectAccounts(ctx context.Context, cfg Config, collect func(context.Context, Account, Config) (accountData, error)) ([]accountData, error) {
+	data := make([]accountData, len(cfg.Accounts))
+	errs := make([]error, len(cfg.Accounts))
+	var wg sync.WaitGroup
+	for i, account := range cfg.Accounts {
+		wg.Add(1)
+		go func(i int, account Account) {
+			defer wg.Done()
+			data[i], errs[i] = collect(ctx, account, cfg)
+			data[i].First = i == 0
+			healthFrom(ctx).Record(account.collector(), errs[i])
+		}(i, account)
+	}
+	wg.Wait()
+
+	result := []accountData{}
+	failed := []error{}
+	for i := range data {
+		var partial *PartialError
+		switch {
+		case errs[i] == nil:
+			result = append(result, data[i])
+		case errors.As(errs[i], &partial):
+			result = append(result, data[i])
+			failed = append(failed, errs[i])
+		default:
+			failed = append(failed, errs[i])
+		}
+	}
+	err := joinPartial(collectorAccounts, failed)
+	if len(result) == 0 {
+		return nil, err
+	}
+
+	return result, err
+}
@@ -0,0 +1,142 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestCollectAccounts(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []Account{{}, {RoleARN: "arn:aws:iam::222:role/cost-report", ExternalID: "id"}}
+	collect := func(_ context.Context, account Account, _ Config) (accountData, error) {
+		if account.RoleARN == "" {
+			return accountData{ID: "111", Spot: []Spot{{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Price: 0.04}}}, nil
+		}
+
+		return accountData{ID: "222", Spot: []Spot{{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "222", Price: 0.05}}}, nil
+	}
+
+	accounts, err := collectAccounts(context.Background(), cfg, collect)
+	if err != nil {
+		t.Fatalf("collectAccounts() error = %v", err)
+	}
+	snapshot := &Snapshot{OnDemand: []*Price{{InstanceType: "m5.large", Price: 0.1}}}
+	snapshot.addAccounts(accounts)
+	if snapshot.AccountID != "111" || len(snapshot.Spot) != 2 {
+		t.Fatalf("addAccounts() = %+v, want the spot prices of both accounts", snapshot)
+	}
+	if got, _ := snapshot.HourlyPrice("m5.large", CapacitySpot, "eu-west-1a"); got != 0.04 {
+		t.Errorf("HourlyPrice() = %v, want the first account price 0.04", got)
+	}
+	if got, _ := snapshot.AccountHourlyPrice("222", "m5.large", CapacitySpot, "eu-west-1a"); got != 0.05 {
+		t.Errorf("AccountHourlyPrice() = %v, want 0.05", got)
+	}
+
+	errAccess := errors.New("access denied")
+	health := NewHealth()
+	accounts, err = collectAccounts(WithHealth(context.Background(), health), cfg, func(ctx context.Context, account Account, cfg Config) (accountData, error) {
+		if account.RoleARN != "" {
+			return accountData{}, errAccess
+		}
+
+		return collect(ctx, account, cfg)
+	})
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Skipped != 1 || !errors.Is(err, errAccess) {
+		t.Errorf("collectAccounts() error = %v, want a partial error skipping %v", err, errAccess)
+	}
+	if len(accounts) != 1 || accounts[0].ID != "111" {
+		t.Errorf("collectAccounts() = %+v, want the account 111 only", accounts)
+	}
+	collectors := health.Collectors()
+	if status := collectors["accounts/default"]; status.LastSuccess == nil {
+		t.Errorf("Collectors() default account = %+v, want a success", status)
+	}
+	if status := collectors["accounts/arn:aws:iam::222:role/cost-report"]; status.LastError != errAccess.Error() {
+		t.Errorf("Collectors() role account = %+v, want the error %v", status, errAccess)
+	}
+
+	accounts, _ = collectAccounts(context.Background(), cfg, func(ctx context.Context, account Account, cfg Config) (accountData, error) {
+		if account.RoleARN == "" {
+			return accountData{}, errAccess
+		}
+
+		return collect(ctx, account, cfg)
+	})
+	snapshot = &Snapshot{OnDemand: []*Price{{InstanceType: "m5.large", Price: 0.1}}}
+	snapshot.addAccounts(accounts)
+	if snapshot.AccountID != "" || len(snapshot.Warnings) != 1 {
+		t.Errorf("addAccounts() = %+v, want no snapshot account and a warning without the first account", snapshot)
+	}
+	if got, ok := snapshot.HourlyPrice("m5.large", CapacityOnDemand, ""); ok {
+		t.Errorf("HourlyPrice() = %v, want no price without the first account", got)
+	}
+
+	accounts, err = collectAccounts(context.Background(), cfg, func(context.Context, Account, Config) (accountData, error) {
+		return accountData{}, errAccess
+	})
+	if accounts != nil || !errors.Is(err, errAccess) {
+		t.Errorf("collectAccounts() = %v, %v, want no account and %v", accounts, err, errAccess)
+	}
+}
+
+func TestConfigAccountsValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []Account{{ExternalID: "id"}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Validate() accepted an external ID without role")
+	}
+	cfg.Accounts = nil
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Validate() accepted no account")
+	}
+	if !reflect.DeepEqual(DefaultConfig().Accounts, []Account{{}}) {
+		t.Errorf("DefaultConfig() accounts = %v, want the exporter account", DefaultConfig().Accounts)
+	}
+}
+
+// fakeAccountEC2 lists the instances but fails the spot price history.
+type fakeAccountEC2 struct {
+	fakeInstancesEC2
+}
+
+func (f *fakeAccountEC2) DescribeSpotPriceHistoryPagesWithContext(aws.Context, *ec2.DescribeSpotPriceHistoryInput, func(*ec2.DescribeSpotPriceHistoryOutput, bool) bool, ...request.Option) error {
+	return errors.New("throttled")
+}
+
+func Test_collectAccountData(t *testing.T) {
+	svc := &fakeAccountEC2{fakeInstancesEC2{pages: []*ec2.DescribeInstancesOutput{{Reservations: []*ec2.Reservation{
+		{Instances: []*ec2.Instance{newInstance("i-1", "m5.large", "eu-west-1a", nil)}},
+	}}}}}
+	data, err := collectAccountData(context.Background(), svc, "111", DefaultConfig())
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Skipped != 1 {
+		t.Errorf("collectAccountData() error = %v, want a partial error skipping the spot prices", err)
+	}
+	if len(data.Instances) != 1 || data.Instances[0].AccountID != "111" {
+		t.Errorf("collectAccountData() instances = %+v, want i-1 in the account 111", data.Instances)
+	}
+}
+
+func TestSnapshotOptional(t *testing.T) {
+	snapshot := &Snapshot{}
+	errFeed := errors.New("feed unavailable")
+	if err := snapshot.optional(context.Background(), collectorCUR, errFeed); err != nil {
+		t.Errorf("optional() error = %v, want the collection skipped", err)
+	}
+	if want := []CollectionWarning{{Operation: collectorCUR, Skipped: 1, Message: errFeed.Error()}}; !reflect.DeepEqual(snapshot.Warnings, want) {
+		t.Errorf("optional() warnings = %v, want %v", snapshot.Warnings, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := snapshot.optional(ctx, collectorCUR, errFeed); !errors.Is(err, errFeed) {
+		t.Errorf("optional() error = %v, want %v once canceled", err, errFeed)
+	}
+}
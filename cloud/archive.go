@@ -0,0 +1,81 @@
+package cloud
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SnapshotVersion is the version of the snapshot archive format, increased on incompatible changes of the snapshot.
+const SnapshotVersion = 1
+
+// snapshotArchive is the gzipped JSON document a snapshot is exported to.
+type snapshotArchive struct {
+	Version int `json:"version"`
+	// Checksum is the hex SHA-256 of the snapshot document.
+	Checksum string          `json:"checksum"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// WriteSnapshot writes the snapshot as a versioned and checksummed archive.
+func WriteSnapshot(w io.Writer, s *Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	gz := gzip.NewWriter(w)
+	archive := snapshotArchive{Version: SnapshotVersion, Checksum: hex.EncodeToString(sum[:]), Snapshot: data}
+	if err := json.NewEncoder(gz).Encode(archive); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ReadSnapshot reads a snapshot archive, checking its version and checksum.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	defer gz.Close()
+
+	var archive snapshotArchive
+	if err := json.NewDecoder(gz).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	if archive.Version != SnapshotVersion {
+		return nil, fmt.Errorf("read snapshot: unsupported version %d, want %d", archive.Version, SnapshotVersion)
+	}
+	sum := sha256.Sum256(archive.Snapshot)
+	if hex.EncodeToString(sum[:]) != archive.Checksum {
+		return nil, fmt.Errorf("read snapshot: checksum mismatch")
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(archive.Snapshot, snapshot); err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// LoadSnapshot reads the snapshot archive in path.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path) // #nosec G304 -- the path comes from the exporter config
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	return ReadSnapshot(file)
+}
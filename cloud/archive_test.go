@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotArchive(t *testing.T) {
+	snapshot := &Snapshot{
+		CollectedAt: time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC),
+		AccountID:   "111",
+		OnDemand:    []*Price{{SKU: "A", InstanceType: "m5.large", CPU: "2", Memory: "8 GiB", Price: 0.107, Unit: "Hrs"}},
+		Spot:        []Spot{{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Price: 0.04}},
+		Instances:   []Instance{{ID: "i-1", InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Lifecycle: LifecycleSpot, Tags: map[string]string{}}},
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json.gz")
+	var b bytes.Buffer
+	if err := WriteSnapshot(&b, snapshot); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, snapshot) {
+		t.Errorf("LoadSnapshot() = %+v, want %+v", got, snapshot)
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	gzipped := func(data string) []byte {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write([]byte(data))
+		w.Close()
+
+		return b.Bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Test not gzipped", data: []byte(`{}`)},
+		{name: "Test unsupported version", data: gzipped(`{"version":0,"checksum":"","snapshot":{}}`)},
+		{name: "Test checksum mismatch", data: gzipped(`{"version":1,"checksum":"00","snapshot":{}}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadSnapshot(bytes.NewReader(tt.data)); err == nil {
+				t.Error("ReadSnapshot() want error")
+			}
+		})
+	}
+}
@@ -2,15 +2,18 @@
 package cloud
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/pricing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -19,21 +22,32 @@ import (
 
 // Price represente an instance.
 type Price struct {
-	InstanceType string
-	Description  string
-	CPU          string
-	Memory       string
-	Price        float64
-	Unit         string
-	AZ           string
-	Region       string
+	SKU            string
+	CapacityStatus string
+	LicenseModel   string
+	InstanceType   string
+	Description    string
+	CPU            string
+	Memory         string
+	Architecture   string
+	Price          float64
+	Unit           string
+	AZ             string
+	Region         string
+	// PublicationDate is the publication time of the price list the product was read from.
+	PublicationDate time.Time
+	// EffectiveDate is the time the on-demand term of the price took effect.
+	EffectiveDate time.Time
 }
 
 // Spot represent the an Spot instance.
 type Spot struct {
 	InstanceType string
 	AZ           string
+	AccountID    string
 	Price        float64
+	// Timestamp is the time of the latest spot price change.
+	Timestamp time.Time
 }
 
 // OnDemandUnitPrice represents the price per unit(1cpu, 1GB) of the instance type.
@@ -52,8 +66,6 @@ type SpotUnitPrice struct {
 }
 
 const (
-	instanceType   = "label_beta_kubernetes_io_instance_type"
-	instanceOption = "label_eks_amazonaws_com_capacity_type"
 	// CPU label.
 	CPU = "vcpu"
 	// Memory label.
@@ -67,8 +79,12 @@ const (
 	// Region label.
 	Region = "region"
 	// Timestamp label.
-	Timestamp      = "timestamp"
-	cpuMemRelation = 7.2
+	Timestamp = "timestamp"
+	// TimestampPublication is the timestamp label value of the price list publication time.
+	TimestampPublication = "publication"
+	// TimestampEffective is the timestamp label value of the time the price took effect.
+	TimestampEffective = "effective"
+	cpuMemRelation     = 7.2
 )
 
 var filtering []*pricing.Filter = []*pricing.Filter{
@@ -102,6 +118,16 @@ var filtering []*pricing.Filter = []*pricing.Filter{
 		Field: aws.String("marketoption"),
 		Value: aws.String("OnDemand"),
 	},
+	{
+		Type:  aws.String("TERM_MATCH"),
+		Field: aws.String("capacitystatus"),
+		Value: aws.String(capacityStatusUsed),
+	},
+	{
+		Type:  aws.String("TERM_MATCH"),
+		Field: aws.String("licenseModel"),
+		Value: aws.String(licenseModelNone),
+	},
 }
 
 // parsingJSONString parse json filet os.
@@ -117,6 +143,16 @@ func parsingJSONFloat(dataByte []byte, key string) float64 {
 	return value
 }
 
+// parsingJSONTime parses an RFC 3339 time, the zero time when missing or invalid.
+func parsingJSONTime(dataByte []byte, key string) time.Time {
+	value, err := time.Parse(time.RFC3339, gjson.Get(string(dataByte), key).String())
+	if err != nil {
+		return time.Time{}
+	}
+
+	return value
+}
+
 func parsingJSONStringArray(dataByte []byte, key string) []string {
 	result := []string{}
 	value := gjson.Get(string(dataByte), key).Array()
@@ -134,15 +170,33 @@ func parsingPrice(priceData aws.JSONValue) (*Price, error) {
 		return nil, fmt.Errorf("parsin price: %w", err)
 	}
 
+	pricing.SKU = parsingJSONString(data, "product.sku")
+	pricing.CapacityStatus = parsingJSONString(data, "product.attributes.capacitystatus")
+	pricing.LicenseModel = parsingJSONString(data, "product.attributes.licenseModel")
 	pricing.CPU = parsingJSONString(data, "product.attributes.vcpu")
 	pricing.InstanceType = parsingJSONString(data, "product.attributes.instanceType")
 	pricing.Memory = parsingJSONString(data, "product.attributes.memory")
+	pricing.Architecture = architecture(parsingJSONString(data, "product.attributes.physicalProcessor"))
 	pricing.Price = parsingJSONFloat(data, "terms.OnDemand.*.priceDimensions.*.pricePerUnit.USD")
 	pricing.Unit = parsingJSONString(data, "terms.OnDemand.*.priceDimensions.*.unit")
+	pricing.PublicationDate = parsingJSONTime(data, "publicationDate")
+	pricing.EffectiveDate = parsingJSONTime(data, "terms.OnDemand.*.effectiveDate")
 
 	return pricing, nil
 }
 
+// architecture returns the CPU architecture of the physical processor.
+func architecture(physicalProcessor string) string {
+	switch {
+	case physicalProcessor == "":
+		return ""
+	case strings.Contains(physicalProcessor, "Graviton"):
+		return "arm64"
+	default:
+		return "x86_64"
+	}
+}
+
 func avg(array []float64) float64 {
 	result := 0.0
 	for _, v := range array {
@@ -201,26 +255,19 @@ func (spot *Spot) CalcUnitPrice(valuespot Spot, price *Price) SpotUnitPrice {
 	}
 }
 
-func groupPricing(spotPrices []*ec2.SpotPrice) []Spot {
-	aggregatedPrices := map[Spot][]float64{}
-	for _, value := range spotPrices {
-		if s, err := strconv.ParseFloat(*value.SpotPrice, 64); err == nil {
-			index := Spot{InstanceType: *value.InstanceType, AZ: *value.AvailabilityZone}
-			aggregatedPrices[index] = append(aggregatedPrices[index], s)
-		}
-	}
-
-	averages := map[Spot]float64{}
-	for key, value := range aggregatedPrices {
-		averages[key] = avg(value)
-	}
-
+// groupPricing returns the time-weighted average spot price between start and end per instance type and AZ.
+func groupPricing(spotPrices []*ec2.SpotPrice, start, end time.Time) []Spot {
 	pricesArray := []Spot{}
-	for key, value := range averages {
+	for key, records := range groupSpotRecords(spotPrices) {
+		records = recordsInWindow(records, start)
+		if len(records) == 0 {
+			continue
+		}
 		spotOne := Spot{
 			InstanceType: key.InstanceType,
 			AZ:           key.AZ,
-			Price:        value,
+			Price:        timeWeightedAvg(records, start, end),
+			Timestamp:    records[len(records)-1].Timestamp,
 		}
 		pricesArray = append(pricesArray, spotOne)
 	}
@@ -228,16 +275,21 @@ func groupPricing(spotPrices []*ec2.SpotPrice) []Spot {
 	return pricesArray
 }
 
-// SpotMetric is the function that returns the average spot price.
-func SpotMetric() ([]Spot, error) {
-	ses, err := session.NewSession()
+// SpotMetric is the function that returns the time-weighted average spot price over the last day
+// and the spot price statistics for the configured windows.
+func SpotMetric(ctx context.Context, cfg Config) ([]Spot, []SpotStat, error) {
+	ses, err := newSession()
 	if err != nil {
-		return nil, fmt.Errorf("session: %w", err)
+		return nil, nil, fmt.Errorf("session: %w", err)
 	}
 
-	svc := ec2.New(ses, aws.NewConfig().WithRegion("eu-west-1"))
+	return spotMetric(ctx, ec2.New(ses, aws.NewConfig().WithRegion("eu-west-1")), cfg)
+}
+
+func spotMetric(ctx context.Context, svc ec2iface.EC2API, cfg Config) ([]Spot, []SpotStat, error) {
 	endTime := time.Now()
-	startTime := endTime.AddDate(0, 0, -1)
+	dayStart := endTime.AddDate(0, 0, -1)
+	startTime := endTime.Add(-maxWindow(cfg.SpotWindows, endTime.Sub(dayStart)))
 	input := &ec2.DescribeSpotPriceHistoryInput{
 		EndTime: &endTime,
 		ProductDescriptions: []*string{
@@ -245,24 +297,32 @@ func SpotMetric() ([]Spot, error) {
 		},
 		StartTime: &startTime,
 	}
+	start := time.Now()
 	var spotPrices []*ec2.SpotPrice
+	progress := progressFrom(ctx)
 	paginator := func(page *ec2.DescribeSpotPriceHistoryOutput, b bool) bool {
 		spotPrices = append(spotPrices, page.SpotPriceHistory...)
+		progress.page(StageSpot, len(page.SpotPriceHistory))
 
 		return !b
 	}
-	err = svc.DescribeSpotPriceHistoryPages(input, paginator)
-	groupPrice := groupPricing(spotPrices)
+	if err := svc.DescribeSpotPriceHistoryPagesWithContext(ctx, input, paginator); err != nil {
+		return nil, nil, fmt.Errorf("describeSpotPriceHistoryPages: %w", err)
+	}
+	slog.DebugContext(ctx, "Listed the spot prices", "operation", "DescribeSpotPriceHistory", "region", "eu-west-1",
+		"count", len(spotPrices), "duration", time.Since(start))
+	groupPrice := groupPricing(spotPrices, dayStart, endTime)
+	stats, err := spotStatistics(spotPrices, cfg.SpotWindows, cfg.SpotStats, endTime)
 	if err != nil {
-		return nil, fmt.Errorf("describeSpotPriceHistoryPages: %w", err)
+		return nil, nil, fmt.Errorf("spot statistics: %w", err)
 	}
 
-	return groupPrice, nil
+	return groupPrice, stats, nil
 }
 
 // PriceMetric is the function that returns the average price.
-func PriceMetric() ([]*Price, error) {
-	ses, err := session.NewSession()
+func PriceMetric(ctx context.Context) ([]*Price, error) {
+	ses, err := newSession()
 	if err != nil {
 		return nil, fmt.Errorf("session: %w", err)
 	}
@@ -275,82 +335,124 @@ func PriceMetric() ([]*Price, error) {
 		ServiceCode: aws.String("AmazonEC2"),
 	}
 
+	start := time.Now()
 	var prices []*Price
+	var parseErrs []error
+	progress := progressFrom(ctx)
 	paginator := func(page *pricing.GetProductsOutput, lastPage bool) bool {
+		progress.page(StageOnDemand, len(page.PriceList))
+		// A product failing to parse is skipped, the other ones are still priced.
 		for _, v := range page.PriceList {
 			price, err2 := parsingPrice(v)
 			if err2 != nil {
-				return false
+				parseErrs = append(parseErrs, err2)
+
+				continue
 			}
 			prices = append(prices, price)
 		}
 
 		return !lastPage
 	}
-	err = svc.GetProductsPages(input, paginator)
+	err = svc.GetProductsPagesWithContext(ctx, input, paginator)
 	if err != nil {
 		return nil, fmt.Errorf("get producs: %w", err)
 	}
+	slog.DebugContext(ctx, "Listed the products", "operation", "GetProducts", "region", "us-east-1",
+		"count", len(prices), "duration", time.Since(start))
+	if len(parseErrs) > 0 {
+		partial := &PartialError{Operation: "GetProducts", Skipped: len(parseErrs), Err: errors.Join(parseErrs...)}
+		if len(prices) == 0 {
+			return nil, partial
+		}
+
+		return prices, partial
+	}
 
 	return prices, nil
 }
 
-func listInstances() ([]string, error) {
-	ses, err := session.NewSession()
+// CollectSnapshot collects all the pricing data from AWS.
+// The public pricing data is collected once and the account data from every account in parallel.
+// The items failing in a collection are skipped with a warning, and so are the collections the prices don't need.
+func CollectSnapshot(ctx context.Context, cfg Config) (*Snapshot, error) {
+	snapshot := &Snapshot{CollectedAt: time.Now()}
+	var err error
+	clients.configure(cfg)
+
+	start := time.Now()
+	var prices []*Price
+	if cfg.OfferFileSource != "" {
+		prices, err = OfferFileMetric(ctx, cfg.OfferFileSource)
+	} else {
+		prices, err = PriceMetric(ctx)
+	}
+	err = snapshot.partial(prices != nil, err)
+	observe(ctx, collectorPrices, start, len(prices), err)
 	if err != nil {
-		return nil, fmt.Errorf("session: %w", err)
+		return nil, err
 	}
-	svc := ec2.New(ses, aws.NewConfig().WithRegion("eu-west-1"))
-
-	input := &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			{
-				Name: aws.String("instance-state-name"),
-				Values: []*string{
-					aws.String("pending"),
-					aws.String("running"),
-					aws.String("shutting-down"),
-					aws.String("terminated"),
-					aws.String("stopping"),
-					aws.String("stopped"),
-				},
-			},
-		},
+	progressFrom(ctx).done(StageOnDemand)
+	snapshot.OnDemand, snapshot.PriceConflicts = selectProducts(prices)
+	if cfg.SpotAdvisorSource != "" {
+		start = time.Now()
+		snapshot.Interruptions, err = SpotInterruptionMetric(ctx, cfg.SpotAdvisorSource)
+		observe(ctx, collectorInterruptions, start, len(snapshot.Interruptions), err)
+		if err := snapshot.optional(ctx, collectorInterruptions, err); err != nil {
+			return nil, err
+		}
 	}
-
-	var instanceTypes []string
-	err = svc.DescribeInstancesPages(input,
-		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
-			data, _ := json.Marshal(page)
-			instanceTypes = parsingJSONStringArray(data, "Reservations.#.Instances.0.InstanceType")
-
-			return !lastPage
-		})
+	start = time.Now()
+	accounts, err := collectAccounts(ctx, cfg, collectAccount)
+	err = snapshot.partial(accounts != nil, err)
+	observe(ctx, collectorAccounts, start, len(accounts), err)
 	if err != nil {
-		return nil, fmt.Errorf("DescribeInstancesPages: %w", err)
+		return nil, err
 	}
-
-	return removeDuplicateStr(instanceTypes), nil
-}
-
-func removeDuplicateStr(strSlice []string) []string {
-	allKeys := make(map[string]bool)
-	list := []string{}
-	for _, item := range strSlice {
-		if _, value := allKeys[item]; !value {
-			allKeys[item] = true
-			list = append(list, item)
+	progressFrom(ctx).done(StageSpot)
+	progressFrom(ctx).done(StageInstances)
+	snapshot.addAccounts(accounts)
+	if cfg.CURSource != "" {
+		start = time.Now()
+		snapshot.CURUsage, err = CURMetric(ctx, cfg, snapshot.CollectedAt)
+		err = snapshot.partial(len(snapshot.CURUsage) > 0, err)
+		observe(ctx, collectorCUR, start, len(snapshot.CURUsage), err)
+		if err := snapshot.optional(ctx, collectorCUR, err); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CostExplorer {
+		start = time.Now()
+		snapshot.DailyCosts, err = CostExplorerMetric(ctx, cfg, snapshot.CollectedAt)
+		err = snapshot.partial(len(snapshot.DailyCosts) > 0, err)
+		observe(ctx, collectorCostExplorer, start, len(snapshot.DailyCosts), err)
+		if err := snapshot.optional(ctx, collectorCostExplorer, err); err != nil {
+			return nil, err
 		}
 	}
+	if len(cfg.Currencies) > 0 {
+		start = time.Now()
+		snapshot.CurrencyRates, err = CurrencyRates(ctx, cfg)
+		err = snapshot.partial(len(snapshot.CurrencyRates) > 0, err)
+		observe(ctx, collectorCurrencyRates, start, len(snapshot.CurrencyRates), err)
+		if err := snapshot.optional(ctx, collectorCurrencyRates, err); err != nil {
+			return nil, err
+		}
+	}
+	// The collections skipped by a canceled refresh are not partial results.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	return list
+	return snapshot, nil
 }
 
-// AWSMetrics export metrics.
-func AWSMetrics() (prometheus.Gatherer, error) {
+// Gatherer exports the snapshot as metrics, labelled with the node label schemas of the config.
+func (s *Snapshot) Gatherer(cfg Config) prometheus.Gatherer {
 	reg := prometheus.NewRegistry()
-	labelNames := []string{instanceType, instanceOption, CPU, Memory, Unit, AZ, Region}
-	labelUnit := []string{instanceType, instanceOption, Unit, AZ, Region}
+	l := newLabeler(cfg.LabelSchemas)
+	labelNames := l.labelNames(CPU, Memory, Unit, Region)
+	labelUnit := l.labelNames(Unit, Region)
 
 	allMachinePricing := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 		Name: "instance_cost_all",
@@ -376,141 +478,261 @@ func AWSMetrics() (prometheus.Gatherer, error) {
 		Name: "instance_discount",
 		Help: "Discount of the instance type",
 	}, labelUnit)
-
-	onDemandPricing, err := PriceMetric()
-	if err != nil {
-		return nil, err
-	}
-	spotPricing, err := SpotMetric()
-	if err != nil {
-		return nil, err
-	}
-	instanceTypes, err := listInstances()
-	if err != nil {
-		return nil, err
-	}
+	spotStats := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_spot_price",
+		Help: "Spot price statistics of the instance type over a window",
+	}, l.labelNames(Unit, Region, Window, Stat))
+	interruptionRate := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_spot_interruption_rate",
+		Help: "Upper bound of the spot interruption frequency band of the instance type",
+	}, l.labelNames(Unit, Region, Band))
+	placementScore := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_spot_placement_score",
+		Help: "Spot placement score of the instance type in the AZ",
+	}, labelUnit)
+	instanceCount := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_count",
+		Help: "Running instances of the instance type in the account",
+	}, l.labelNames(Lifecycle, Region))
+	instanceCost := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ec2_instance_cost_hourly",
+		Help: "Hourly cost of the running EC2 instance",
+	}, append([]string{AccountID, "instance_id", "instance_type", "az", "lifecycle"}, cfg.tagLabelNames()...))
+	curLabels := []string{AccountID, "instance_type", "capacity_type", Date}
+	curCost := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cur_instance_cost_daily",
+		Help: "Cost of the instance type on the day from the Cost and Usage Report",
+	}, curLabels)
+	curEstimatedCost := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cur_instance_estimated_cost_daily",
+		Help: "Cost of the instance type on the day estimated from the usage hours of the Cost and Usage Report",
+	}, curLabels)
+	curRatio := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cur_instance_cost_ratio",
+		Help: "Ratio of the Cost and Usage Report cost to the estimated cost of the instance type on the day",
+	}, curLabels)
+	dailyCost := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cost_explorer_cost_daily",
+		Help: "Actual spend of the service usage type on the day from Cost Explorer",
+	}, []string{AccountID, "service", "usage_type", Date})
+	dailyTagCost := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cost_explorer_tag_cost_daily",
+		Help: "Actual spend of the service for the cost allocation tag value on the day from Cost Explorer",
+	}, []string{AccountID, "service", "tag", "value", Date})
+	priceInfo := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_price_info",
+		Help: "SKU of the product the on-demand price of the instance type is read from",
+	}, l.labelNames(SKU, Region))
+	priceConflicts := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_price_conflicts",
+		Help: "Products of the instance type equally ranked by the selection rules with different prices",
+	}, l.labelNames(Region))
+	accountInfo := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "snapshot_account_info",
+		Help: "First account of the config, the cluster one the node costs are computed for",
+	}, []string{AccountID})
+	skippedItems := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "snapshot_skipped_items",
+		Help: "Items skipped by the collection of the snapshot that returned the other ones",
+	}, []string{"operation"})
+	priceTimestamp := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "instance_price_effective_timestamp_seconds",
+		Help: "Unix time the price of the instance type was published or took effect",
+	}, l.labelNames(Timestamp, Region))
 
 	// All machine pricing calculation
 	// In Use machine price calculation
-	instancePriceCalc(onDemandPricing, allMachinePricing, vCPUPricing, memPricing, inUseMachinePricing, instanceTypes)
+	instancePriceCalc(l, s, allMachinePricing, vCPUPricing, memPricing, inUseMachinePricing)
+
+	// Product selected for the on-demand prices
+	productCalc(l, s, priceInfo, priceConflicts)
+
+	// Publication and effective time of the prices
+	priceTimestampCalc(l, s, priceTimestamp)
 
 	// Spot machine pricing calculation
 	// All machine pricing calculation
 	// In Use machine price calculation
-	spotInstancePriceCalc(spotPricing, onDemandPricing, allMachinePricing, vCPUPricing, memPricing, capacity, discount, inUseMachinePricing, instanceTypes)
+	spotInstancePriceCalc(l, s, allMachinePricing, vCPUPricing, memPricing, capacity, discount, inUseMachinePricing)
+
+	// Spot price statistics per window
+	spotStatsCalc(l, s.SpotStats, spotStats)
+
+	// Spot interruption risk per AZ
+	spotRiskCalc(l, s.Spot, s.Interruptions, s.PlacementScores, interruptionRate, placementScore)
 
-	return reg, nil
+	// Running instances per AZ
+	instanceCountCalc(l, countInstances(s.Instances), instanceCount)
+
+	// Running instance cost with their tags
+	instanceCostCalc(s, cfg.InstanceTagLabels, instanceCost)
+
+	// Cost and Usage Report reconciliation
+	curCalc(s, curCost, curEstimatedCost, curRatio)
+
+	// Cost Explorer daily spend
+	dailyCostCalc(s.DailyCosts, dailyCost, dailyTagCost)
+
+	// Cluster account, the AZ names of the spot prices being specific to every account
+	if s.AccountID != "" {
+		accountInfo.WithLabelValues(s.AccountID).Set(1)
+	}
+
+	// Partial results of the collection
+	for _, warning := range s.Warnings {
+		skippedItems.WithLabelValues(warning.Operation).Add(float64(warning.Skipped))
+	}
+
+	return reg
 }
 
-func spotInstancePriceCalc(spotPricing []Spot, onDemandPricing []*Price, allMachinePricing, vCPUPricing, memPricing, capacity, discount, inUseMachinePricing *prometheus.GaugeVec, instanceTypes []string) {
-	for _, valueSpot := range spotPricing {
-		for _, valueOnDemand := range onDemandPricing {
-			if valueSpot.InstanceType == valueOnDemand.InstanceType {
-				allMachinePricing.With(prometheus.Labels{
-					instanceType:   valueSpot.InstanceType,
-					instanceOption: "SPOT",
-					CPU:            valueOnDemand.CPU,
-					Memory:         valueOnDemand.Memory,
-					Unit:           "Hrs",
-					AZ:             valueSpot.AZ,
-					Region:         "eu-west-1",
-				}).Set(valueSpot.Price)
-				spotUnitPrice := valueSpot.CalcUnitPrice(valueSpot, valueOnDemand)
-				vCPUPricing.With(prometheus.Labels{
-					instanceType:   valueSpot.InstanceType,
-					instanceOption: "SPOT",
-					Unit:           "Hrs",
-					AZ:             valueSpot.AZ,
-					Region:         "eu-west-1",
-				}).Set(spotUnitPrice.CPUPrice)
-				memPricing.With(prometheus.Labels{
-					instanceType:   valueSpot.InstanceType,
-					instanceOption: "SPOT",
-					Unit:           "Hrs",
-					AZ:             valueSpot.AZ,
-					Region:         "eu-west-1",
-				}).Set(spotUnitPrice.MemPrice)
-				capacity.With(prometheus.Labels{
-					instanceType:   valueSpot.InstanceType,
-					instanceOption: "SPOT",
-					Unit:           "Hrs",
-					AZ:             valueSpot.AZ,
-					Region:         "eu-west-1",
-				}).Set(spotUnitPrice.Capacity)
-				discount.With(prometheus.Labels{
-					instanceType:   valueSpot.InstanceType,
-					instanceOption: "SPOT",
-					Unit:           "Hrs",
-					AZ:             valueSpot.AZ,
-					Region:         "eu-west-1",
-				}).Set(spotUnitPrice.Discount)
-
-				inUseOnDemnandMachineCalc(instanceTypes, valueSpot, inUseMachinePricing, valueOnDemand)
+// AWSMetrics export metrics.
+func AWSMetrics(ctx context.Context, cfg Config) (prometheus.Gatherer, error) {
+	snapshot, err := CollectSnapshot(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.Gatherer(cfg), nil
+}
+
+func spotRiskCalc(l labeler, spotPricing []Spot, interruptions []SpotInterruption, placementScores []SpotPlacementScore, interruptionRate, placementScore *prometheus.GaugeVec) {
+	// The spot advisor bands are per region, so they are exported for every AZ offering the instance type.
+	for _, interruption := range interruptions {
+		for _, valueSpot := range spotPricing {
+			if valueSpot.InstanceType == interruption.InstanceType {
+				l.set(interruptionRate, interruption.InstanceType, "SPOT", valueSpot.AZ, prometheus.Labels{
+					AccountID: valueSpot.AccountID,
+					Unit:      "Hrs",
+					Region:    interruption.Region,
+					Band:      interruption.Band,
+				}, interruption.Rate)
 			}
 		}
 	}
+	for _, score := range placementScores {
+		l.set(placementScore, score.InstanceType, "SPOT", score.AZ, prometheus.Labels{
+			AccountID: score.AccountID,
+			Unit:      "Hrs",
+			Region:    "eu-west-1",
+		}, score.Score)
+	}
 }
 
-func instancePriceCalc(onDemandPricing []*Price, allMachinePricing, vCPUPricing, memPricing, inUseMachinePricing *prometheus.GaugeVec, instanceTypes []string) {
-	for _, price := range onDemandPricing {
-		onDemandUnitPrice := price.CalcUnitPrice()
+func spotStatsCalc(l labeler, spotStatistics []SpotStat, spotStats *prometheus.GaugeVec) {
+	for _, stat := range spotStatistics {
+		l.set(spotStats, stat.InstanceType, "SPOT", stat.AZ, prometheus.Labels{
+			AccountID: stat.AccountID,
+			Unit:      "Hrs",
+			Region:    "eu-west-1",
+			Window:    stat.Window,
+			Stat:      stat.Stat,
+		}, stat.Value)
+	}
+}
+
+func instanceCountCalc(l labeler, instances []InstanceCount, instanceCount *prometheus.GaugeVec) {
+	for _, instance := range instances {
+		l.set(instanceCount, instance.InstanceType, instance.CapacityType(), instance.AZ, prometheus.Labels{
+			AccountID: instance.AccountID,
+			Lifecycle: instance.Lifecycle,
+			Region:    "eu-west-1",
+		}, float64(instance.Count))
+	}
+}
 
-		allMachinePricing.With(prometheus.Labels{
-			instanceType:   price.InstanceType,
-			instanceOption: "ON_DEMAND",
-			CPU:            price.CPU,
-			Memory:         price.Memory,
-			Unit:           price.Unit,
-			AZ:             "",
-			Region:         "eu-west-1",
-		}).Set(price.Price)
-		vCPUPricing.With(prometheus.Labels{
-			instanceType:   price.InstanceType,
-			instanceOption: "ON_DEMAND",
-			Unit:           price.Unit,
-			AZ:             "",
-			Region:         "eu-west-1",
-		}).Set(onDemandUnitPrice.CPUPrice)
-		memPricing.With(prometheus.Labels{
-			instanceType:   price.InstanceType,
-			instanceOption: "ON_DEMAND",
-			Unit:           price.Unit,
-			AZ:             "",
-			Region:         "eu-west-1",
-		}).Set(onDemandUnitPrice.MemPrice)
-
-		inUseSpotMachineCalc(instanceTypes, price, inUseMachinePricing)
+func priceTimestampCalc(l labeler, s *Snapshot, priceTimestamp *prometheus.GaugeVec) {
+	setTimestamp := func(instanceType, capacityType, az, accountID, kind string, t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		l.set(priceTimestamp, instanceType, capacityType, az, prometheus.Labels{
+			AccountID: accountID,
+			Timestamp: kind,
+			Region:    "eu-west-1",
+		}, float64(t.Unix()))
+	}
+	for _, price := range s.OnDemand {
+		setTimestamp(price.InstanceType, CapacityOnDemand, "", "", TimestampPublication, price.PublicationDate)
+		setTimestamp(price.InstanceType, CapacityOnDemand, "", "", TimestampEffective, price.EffectiveDate)
+	}
+	for _, spot := range s.Spot {
+		setTimestamp(spot.InstanceType, CapacitySpot, spot.AZ, spot.AccountID, TimestampEffective, spot.Timestamp)
 	}
 }
 
-func inUseSpotMachineCalc(instanceTypes []string, price *Price, inUseMachinePricing *prometheus.GaugeVec) {
-	for _, w := range instanceTypes {
-		if w == price.InstanceType {
-			inUseMachinePricing.With(prometheus.Labels{
-				instanceType:   price.InstanceType,
-				instanceOption: "ON_DEMAND",
-				CPU:            price.CPU,
-				Memory:         price.Memory,
-				Unit:           price.Unit,
-				AZ:             "",
-				Region:         "eu-west-1",
-			}).Set(price.Price)
+func spotInstancePriceCalc(l labeler, s *Snapshot, allMachinePricing, vCPUPricing, memPricing, capacity, discount, inUseMachinePricing *prometheus.GaugeVec) {
+	for _, valueSpot := range s.Spot {
+		for _, valueOnDemand := range s.OnDemand {
+			if valueSpot.InstanceType == valueOnDemand.InstanceType {
+				l.set(allMachinePricing, valueSpot.InstanceType, "SPOT", valueSpot.AZ, prometheus.Labels{
+					AccountID: valueSpot.AccountID,
+					CPU:       valueOnDemand.CPU,
+					Memory:    valueOnDemand.Memory,
+					Unit:      "Hrs",
+					Region:    "eu-west-1",
+				}, valueSpot.Price)
+				spotUnitPrice := valueSpot.CalcUnitPrice(valueSpot, valueOnDemand)
+				unitLabels := prometheus.Labels{
+					AccountID: valueSpot.AccountID,
+					Unit:      "Hrs",
+					Region:    "eu-west-1",
+				}
+				l.set(vCPUPricing, valueSpot.InstanceType, "SPOT", valueSpot.AZ, unitLabels, spotUnitPrice.CPUPrice)
+				l.set(memPricing, valueSpot.InstanceType, "SPOT", valueSpot.AZ, unitLabels, spotUnitPrice.MemPrice)
+				l.set(capacity, valueSpot.InstanceType, "SPOT", valueSpot.AZ, unitLabels, spotUnitPrice.Capacity)
+				l.set(discount, valueSpot.InstanceType, "SPOT", valueSpot.AZ, unitLabels, spotUnitPrice.Discount)
+
+				if s.InUse(valueSpot.AccountID, valueSpot.InstanceType, CapacitySpot, valueSpot.AZ) {
+					inUseOnDemnandMachineCalc(l, valueSpot, inUseMachinePricing, valueOnDemand)
+				}
+			}
 		}
 	}
 }
 
-func inUseOnDemnandMachineCalc(instanceTypes []string, valueSpot Spot, inUseMachinePricing *prometheus.GaugeVec, valueOnDemand *Price) {
-	for _, w := range instanceTypes {
-		if w == valueSpot.InstanceType {
-			inUseMachinePricing.With(prometheus.Labels{
-				instanceType:   valueSpot.InstanceType,
-				instanceOption: "SPOT",
-				CPU:            valueOnDemand.CPU,
-				Memory:         valueOnDemand.Memory,
-				Unit:           "Hrs",
-				AZ:             valueSpot.AZ,
-				Region:         "eu-west-1",
-			}).Set(valueSpot.Price)
+func instancePriceCalc(l labeler, s *Snapshot, allMachinePricing, vCPUPricing, memPricing, inUseMachinePricing *prometheus.GaugeVec) {
+	for _, price := range s.OnDemand {
+		onDemandUnitPrice := price.CalcUnitPrice()
+
+		l.set(allMachinePricing, price.InstanceType, "ON_DEMAND", "", prometheus.Labels{
+			CPU:    price.CPU,
+			Memory: price.Memory,
+			Unit:   price.Unit,
+			Region: "eu-west-1",
+		}, price.Price)
+		unitLabels := prometheus.Labels{
+			Unit:   price.Unit,
+			Region: "eu-west-1",
+		}
+		l.set(vCPUPricing, price.InstanceType, "ON_DEMAND", "", unitLabels, onDemandUnitPrice.CPUPrice)
+		l.set(memPricing, price.InstanceType, "ON_DEMAND", "", unitLabels, onDemandUnitPrice.MemPrice)
+
+		// The on-demand prices are the same in every account, only the in use ones are per account.
+		for _, accountID := range s.accountIDs() {
+			if s.InUse(accountID, price.InstanceType, CapacityOnDemand, "") {
+				inUseSpotMachineCalc(l, accountID, price, inUseMachinePricing)
+			}
 		}
 	}
 }
+
+func inUseSpotMachineCalc(l labeler, accountID string, price *Price, inUseMachinePricing *prometheus.GaugeVec) {
+	l.set(inUseMachinePricing, price.InstanceType, "ON_DEMAND", "", prometheus.Labels{
+		AccountID: accountID,
+		CPU:       price.CPU,
+		Memory:    price.Memory,
+		Unit:      price.Unit,
+		Region:    "eu-west-1",
+	}, price.Price)
+}
+
+func inUseOnDemnandMachineCalc(l labeler, valueSpot Spot, inUseMachinePricing *prometheus.GaugeVec, valueOnDemand *Price) {
+	l.set(inUseMachinePricing, valueSpot.InstanceType, "SPOT", valueSpot.AZ, prometheus.Labels{
+		AccountID: valueSpot.AccountID,
+		CPU:       valueOnDemand.CPU,
+		Memory:    valueOnDemand.Memory,
+		Unit:      "Hrs",
+		Region:    "eu-west-1",
+	}, valueSpot.Price)
+}
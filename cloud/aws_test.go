@@ -1,14 +1,18 @@
 package cloud
 
 import (
+	"context"
+	"math"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func skipCI(t *testing.T) {
@@ -113,16 +117,21 @@ func TestParsingPrice(t *testing.T) {
 			name: "Test Parsing Price",
 			args: args{
 				PriceData: aws.JSONValue{
+					"publicationDate": "2022-10-05T20:47:09Z",
 					"product": aws.JSONValue{
+						"sku": "2XG6HUS4VQF3KPJ7",
 						"attributes": aws.JSONValue{
-							"vcpu":         "1.0",
-							"instanceType": "t2.micro",
-							"memory":       "1.0",
+							"vcpu":           "1.0",
+							"instanceType":   "t2.micro",
+							"memory":         "1.0",
+							"capacitystatus": "Used",
+							"licenseModel":   "No License required",
 						},
 					},
 					"terms": aws.JSONValue{
 						"OnDemand": aws.JSONValue{
 							"1.0": aws.JSONValue{
+								"effectiveDate": "2022-10-01T00:00:00Z",
 								"priceDimensions": aws.JSONValue{
 									"t2.micro": aws.JSONValue{
 										"pricePerUnit": aws.JSONValue{
@@ -138,11 +147,16 @@ func TestParsingPrice(t *testing.T) {
 				},
 			},
 			want: &Price{
-				InstanceType: "t2.micro",
-				CPU:          "1.0",
-				Memory:       "1.0",
-				Price:        2.0,
-				Unit:         "Hrs",
+				SKU:             "2XG6HUS4VQF3KPJ7",
+				CapacityStatus:  "Used",
+				LicenseModel:    "No License required",
+				InstanceType:    "t2.micro",
+				CPU:             "1.0",
+				Memory:          "1.0",
+				Price:           2.0,
+				Unit:            "Hrs",
+				PublicationDate: time.Date(2022, 10, 5, 20, 47, 9, 0, time.UTC),
+				EffectiveDate:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
 			},
 		},
 	}
@@ -187,6 +201,8 @@ func Test_avg(t *testing.T) {
 }
 
 func Test_groupPricing(t *testing.T) {
+	end := time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -1)
 	type args struct {
 		spotPrices []*ec2.SpotPrice
 	}
@@ -204,14 +220,14 @@ func Test_groupPricing(t *testing.T) {
 						InstanceType:       aws.String("t2.micro"),
 						ProductDescription: aws.String("Linux/UNIX (Amazon VPC)"),
 						SpotPrice:          aws.String("0.01"),
-						Timestamp:          aws.Time(time.Now()),
+						Timestamp:          aws.Time(start),
 					},
 					{
 						AvailabilityZone:   aws.String("us-east-1a"),
 						InstanceType:       aws.String("t2.micro"),
 						ProductDescription: aws.String("Linux/UNIX (Amazon VPC)"),
 						SpotPrice:          aws.String("0.02"),
-						Timestamp:          aws.Time(time.Now()),
+						Timestamp:          aws.Time(start.Add(12 * time.Hour)),
 					},
 				},
 			},
@@ -220,6 +236,7 @@ func Test_groupPricing(t *testing.T) {
 					InstanceType: "t2.micro",
 					AZ:           "us-east-1a",
 					Price:        0.015,
+					Timestamp:    start.Add(12 * time.Hour),
 				},
 			},
 		},
@@ -232,7 +249,7 @@ func Test_groupPricing(t *testing.T) {
 						InstanceType:       aws.String("t2.micro"),
 						ProductDescription: aws.String("Linux/UNIX (Amazon VPC)"),
 						SpotPrice:          aws.String("0.03"),
-						Timestamp:          aws.Time(time.Now()),
+						Timestamp:          aws.Time(end.Add(-time.Hour)),
 					},
 				},
 			},
@@ -241,14 +258,51 @@ func Test_groupPricing(t *testing.T) {
 					InstanceType: "t2.micro",
 					AZ:           "us-east-1b",
 					Price:        0.03,
+					Timestamp:    end.Add(-time.Hour),
+				},
+			},
+		},
+		{
+			name: "Test Group Pricing time-weighted",
+			args: args{
+				spotPrices: []*ec2.SpotPrice{
+					{
+						AvailabilityZone:   aws.String("us-east-1c"),
+						InstanceType:       aws.String("t2.micro"),
+						ProductDescription: aws.String("Linux/UNIX (Amazon VPC)"),
+						SpotPrice:          aws.String("0.06"),
+						Timestamp:          aws.Time(end.Add(-6 * time.Hour)),
+					},
+					{
+						AvailabilityZone:   aws.String("us-east-1c"),
+						InstanceType:       aws.String("t2.micro"),
+						ProductDescription: aws.String("Linux/UNIX (Amazon VPC)"),
+						SpotPrice:          aws.String("0.02"),
+						Timestamp:          aws.Time(start.Add(-48 * time.Hour)),
+					},
+				},
+			},
+			want: []Spot{
+				{
+					InstanceType: "t2.micro",
+					AZ:           "us-east-1c",
+					Price:        0.03,
+					Timestamp:    end.Add(-6 * time.Hour),
 				},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := groupPricing(tt.args.spotPrices); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("groupPricing() = %v, want %v", got, tt.want)
+			got := groupPricing(tt.args.spotPrices, start, end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("groupPricing() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].InstanceType != tt.want[i].InstanceType || got[i].AZ != tt.want[i].AZ ||
+					math.Abs(got[i].Price-tt.want[i].Price) > 1e-9 || !got[i].Timestamp.Equal(tt.want[i].Timestamp) {
+					t.Errorf("groupPricing() = %v, want %v", got, tt.want)
+				}
 			}
 		})
 	}
@@ -268,7 +322,7 @@ func TestSpotMetric(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := SpotMetric()
+			got, _, err := SpotMetric(context.Background(), DefaultConfig())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("SpotMetric() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -294,7 +348,7 @@ func TestPriceMetric(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := PriceMetric()
+			got, err := PriceMetric(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PriceMetric() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -321,7 +375,7 @@ func TestAWSMetrics(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := AWSMetrics()
+			_, err := AWSMetrics(context.Background(), DefaultConfig())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AWSMetrics() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -331,52 +385,48 @@ func TestAWSMetrics(t *testing.T) {
 	}
 }
 
-func Test_listInstances(t *testing.T) {
-	skipCI(t)
-	tests := []struct {
-		name    string
-		want    []string
-		wantErr bool
-	}{
-		{
-			name:    "Test List Instances",
-			want:    []string{"i-0f8f8f8f8f8f8f8f8", "i-0f8f8f8f8f8f8f8f8"},
-			wantErr: false,
+func Test_priceTimestampCalc(t *testing.T) {
+	snapshot := &Snapshot{
+		OnDemand: []*Price{{InstanceType: "m5.large", PublicationDate: time.Unix(1665000000, 0), EffectiveDate: time.Unix(1664582400, 0)}},
+		Spot: []Spot{
+			{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Timestamp: time.Unix(1665400000, 0)},
+			{InstanceType: "m5.large", AZ: "eu-west-1b", AccountID: "111"},
 		},
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := listInstances()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("listInstances() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if len(got) == 0 {
-				t.Errorf("listInstances() = %v, want %v", len(got), tt.want)
-			}
-		})
+	l := newLabeler([]LabelSchema{DefaultLabelSchema()})
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ts", Help: "Timestamp"}, l.labelNames(Timestamp, Region))
+	priceTimestampCalc(l, snapshot, vec)
+
+	want := `
+# HELP ts Timestamp
+# TYPE ts gauge
+ts{account_id="",label_beta_kubernetes_io_instance_type="m5.large",label_eks_amazonaws_com_capacity_type="ON_DEMAND",label_topology_kubernetes_io_zone="",region="eu-west-1",timestamp="effective"} 1.6645824e+09
+ts{account_id="",label_beta_kubernetes_io_instance_type="m5.large",label_eks_amazonaws_com_capacity_type="ON_DEMAND",label_topology_kubernetes_io_zone="",region="eu-west-1",timestamp="publication"} 1.665e+09
+ts{account_id="111",label_beta_kubernetes_io_instance_type="m5.large",label_eks_amazonaws_com_capacity_type="SPOT",label_topology_kubernetes_io_zone="eu-west-1a",region="eu-west-1",timestamp="effective"} 1.6654e+09
+`
+	if err := testutil.CollectAndCompare(vec, strings.NewReader(want)); err != nil {
+		t.Error(err)
 	}
 }
 
-func Test_removeDuplicateStr(t *testing.T) {
-	type args struct {
-		strSlice []string
-	}
+func TestSnapshotGathererAccountInfo(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want []string
+		name      string
+		accountID string
+		want      string
 	}{
-		{
-			name: "Test remove duplicate string",
-			args: args{strSlice: []string{"us-east-1a", "us-east-1b", "us-east-1a"}},
-			want: []string{"us-east-1a", "us-east-1b"},
-		},
+		{name: "collected", accountID: "111", want: `
+# HELP snapshot_account_info First account of the config, the cluster one the node costs are computed for
+# TYPE snapshot_account_info gauge
+snapshot_account_info{account_id="111"} 1
+`},
+		{name: "not collected"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := removeDuplicateStr(tt.args.strSlice); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("removeDuplicateStr() = %v, want %v", got, tt.want)
+			g := (&Snapshot{AccountID: tt.accountID}).Gatherer(DefaultConfig())
+			if err := testutil.GatherAndCompare(g, strings.NewReader(tt.want), "snapshot_account_info"); err != nil {
+				t.Error(err)
 			}
 		})
 	}
@@ -0,0 +1,372 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// OverheadSeparate allocates the idle and system node costs to the __idle__ and __system__ namespaces.
+	OverheadSeparate = "separate"
+	// OverheadProportional allocates the idle and system node costs to the pods in proportion to their cost.
+	OverheadProportional = "proportional"
+	// OverheadEven allocates the idle and system node costs evenly to the pods of the node.
+	OverheadEven = "even"
+
+	// LogFormatJSON logs a JSON object per line.
+	LogFormatJSON = "json"
+	// LogFormatText logs key=value pairs per line.
+	LogFormatText = "text"
+)
+
+// Config holds the settings of the exporter.
+type Config struct {
+	// SpotWindows are the windows used to compute the spot price statistics, e.g. 1h, 24h or 7d.
+	SpotWindows []string `json:"spotWindows"`
+	// SpotStats are the statistics exported for every spot window.
+	SpotStats []string `json:"spotStats"`
+	// RefreshTokenFile is the path of the bearer token authorizing the manual refreshes.
+	RefreshTokenFile string `json:"refreshTokenFile"`
+	// RefreshMinInterval is the minimum time between two manual refreshes, e.g. 1m.
+	RefreshMinInterval string `json:"refreshMinInterval"`
+	// TLSCertFile and TLSKeyFile are the certificate and key the exporter serves HTTPS with, HTTP when empty.
+	TLSCertFile string `json:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile"`
+	// TLSClientCAFile is the CA bundle verifying the client certificates authorizing the manual refreshes.
+	TLSClientCAFile string `json:"tlsClientCAFile"`
+	// RefreshTimeout is the deadline of a refresh, e.g. 10m.
+	RefreshTimeout string `json:"refreshTimeout"`
+	// SnapshotMaxAge is the age of the snapshot above which the exporter is not ready, e.g. 25h.
+	SnapshotMaxAge string `json:"snapshotMaxAge"`
+	// AWSMaxRetries is the number of retries of a failed AWS API request, with exponential backoff and jitter.
+	AWSMaxRetries int `json:"awsMaxRetries"`
+	// AWSRateLimit is the number of AWS API requests per second of all the clients, retries included.
+	AWSRateLimit float64 `json:"awsRateLimit"`
+	// AWSRateBurst is the number of AWS API requests sent at once above the rate limit.
+	AWSRateBurst int `json:"awsRateBurst"`
+	// SnapshotFile is the path of a snapshot archive the exporter serves instead of collecting from AWS.
+	// The file is watched and reloaded when it changes.
+	SnapshotFile string `json:"snapshotFile"`
+	// OfferFileSource is the URL or path of the EC2 regional offer file the on-demand prices are read from.
+	// They are queried from the price list API when empty.
+	OfferFileSource string `json:"offerFileSource"`
+	// SpotAdvisorSource is the URL or path of the spot advisor data. Interruption rates are not exported when empty.
+	SpotAdvisorSource string `json:"spotAdvisorSource"`
+	// PlacementScoreInstanceTypes are the instance types to query the spot placement score for.
+	PlacementScoreInstanceTypes []string `json:"placementScoreInstanceTypes"`
+	// PlacementScoreTargetCapacity is the number of instances requested when querying the spot placement score.
+	PlacementScoreTargetCapacity int64 `json:"placementScoreTargetCapacity"`
+	// NodeCost enables the node cost metrics computed from the nodes in the Kubernetes API.
+	NodeCost bool `json:"nodeCost"`
+	// PodCost enables the pod and namespace cost metrics allocated from the node costs.
+	PodCost bool `json:"podCost"`
+	// OverheadPolicy is how the idle and system overhead node costs are allocated: separate, proportional or even.
+	OverheadPolicy string `json:"overheadPolicy"`
+	// LabelSchemas are the node label keys of the provisioning systems in the cluster, e.g. EKS managed node groups and Karpenter.
+	// The metrics are exported once per schema so they join with the nodes of every system.
+	LabelSchemas []LabelSchema `json:"labelSchemas"`
+	// InstanceTagLabels maps label names of the per instance cost to the EC2 tag keys they are read from.
+	// The labels mapped to an empty tag key are not exported.
+	InstanceTagLabels map[string]string `json:"instanceTagLabels"`
+	// Accounts are the accounts the in-use instances and spot prices are collected from, in parallel.
+	// The first one is the account of the cluster, used for the node costs and the recommendations.
+	Accounts []Account `json:"accounts"`
+	// CURSource is the path or s3://bucket/prefix of the Cost and Usage Report files reconciled with the estimates.
+	// The reconciliation is disabled when empty.
+	CURSource string `json:"curSource"`
+	// CUREndpoint is the endpoint of an S3-compatible storage holding the report files.
+	CUREndpoint string `json:"curEndpoint"`
+	// CURDays is the number of days reconciled, including the current one.
+	CURDays int `json:"curDays"`
+	// CostExplorer enables the daily spend from Cost Explorer of the first account.
+	CostExplorer bool `json:"costExplorer"`
+	// CostExplorerDays is the number of days of spend queried, including the current one.
+	CostExplorerDays int `json:"costExplorerDays"`
+	// CostExplorerTags are the cost allocation tags the spend is grouped by on top of the usage types.
+	CostExplorerTags []string `json:"costExplorerTags"`
+	// Currencies are the ISO 4217 codes the prices and costs are also exported in, with the currency label.
+	Currencies []string `json:"currencies"`
+	// CurrencyRates are the static exchange rates as units of currency per USD, used when no rate source is set.
+	CurrencyRates map[string]float64 `json:"currencyRates"`
+	// CurrencyRateSource is the URL or path of a feed in the ECB reference rates format the exchange rates are read from.
+	CurrencyRateSource string `json:"currencyRateSource"`
+	// LogLevel is the minimum level of the logs: debug, info, warn or error.
+	LogLevel string `json:"logLevel"`
+	// LogFormat is the format of the logs: json or text.
+	LogFormat string `json:"logFormat"`
+	// LeaderElection elects with a Kubernetes lease the replica collecting the snapshots from AWS,
+	// the other replicas fetching the snapshot of the leader.
+	LeaderElection bool `json:"leaderElection"`
+	// LeaseName is the name of the lease of the leader election.
+	LeaseName string `json:"leaseName"`
+	// LeaseNamespace is the namespace of the lease, the one of the POD_NAMESPACE environment variable when empty.
+	LeaseNamespace string `json:"leaseNamespace"`
+	// LeaseDuration is how long the followers wait before taking over a lease not renewed, e.g. 15s.
+	LeaseDuration string `json:"leaseDuration"`
+	// LeaderSyncInterval is how often the followers check the leader for a new snapshot, e.g. 1m.
+	LeaderSyncInterval string `json:"leaderSyncInterval"`
+	// LeaderTLSCAFile is the CA bundle the followers verify the certificate of the leader with, the client CA
+	// bundle or the system roots when empty.
+	LeaderTLSCAFile string `json:"leaderTlsCAFile"`
+	// LeaderTLSServerName is the name the followers verify the certificate of the leader for, its pod IP when empty.
+	LeaderTLSServerName string `json:"leaderTlsServerName"`
+}
+
+// DefaultConfig returns the configuration used when no config file is provided.
+func DefaultConfig() Config {
+	return Config{
+		SpotWindows: []string{"1h", "24h", "7d"},
+		SpotStats:   []string{StatMin, StatMax, StatAvg, StatP50, StatP95, StatStdDev, StatLast},
+
+		PlacementScoreTargetCapacity: 1,
+		OverheadPolicy:               OverheadSeparate,
+		LabelSchemas:                 []LabelSchema{DefaultLabelSchema()},
+		InstanceTagLabels: map[string]string{
+			"cluster":   "eks:cluster-name",
+			"nodegroup": "eks:nodegroup-name",
+		},
+		Accounts: []Account{{}},
+		CURDays:  7,
+
+		CostExplorerDays: 7,
+
+		RefreshTimeout:     "10m",
+		RefreshMinInterval: "1m",
+		SnapshotMaxAge:     "25h",
+		LogLevel:           "info",
+		LogFormat:          LogFormatJSON,
+		LeaseName:          "cost-report",
+		LeaseDuration:      "15s",
+		LeaderSyncInterval: "1m",
+		AWSMaxRetries:      8,
+		AWSRateLimit:       10,
+		AWSRateBurst:       10,
+	}
+}
+
+// LoadConfig reads the JSON config file in path on top of the default configuration.
+// An empty path returns the default configuration.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse config: %w", err)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the configuration values.
+func (c Config) Validate() error {
+	for _, w := range c.SpotWindows {
+		if _, err := parseWindow(w); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.SpotStats {
+		if _, ok := statFuncs[s]; !ok {
+			return fmt.Errorf("unknown spot stat %q", s)
+		}
+	}
+
+	switch c.OverheadPolicy {
+	case OverheadSeparate, OverheadProportional, OverheadEven:
+	default:
+		return fmt.Errorf("unknown overhead policy %q", c.OverheadPolicy)
+	}
+	if len(c.PlacementScoreInstanceTypes) > 0 && c.PlacementScoreTargetCapacity < 1 {
+		return fmt.Errorf("invalid placement score target capacity %d", c.PlacementScoreTargetCapacity)
+	}
+	if len(c.LabelSchemas) == 0 {
+		return fmt.Errorf("at least one label schema is required")
+	}
+	for _, schema := range c.LabelSchemas {
+		if err := schema.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.Accounts) == 0 {
+		return fmt.Errorf("at least one account is required")
+	}
+	for _, account := range c.Accounts {
+		if account.RoleARN == "" && account.ExternalID != "" {
+			return fmt.Errorf("external ID %q without role ARN", account.ExternalID)
+		}
+	}
+	if _, err := parseWindow(c.RefreshTimeout); err != nil {
+		return fmt.Errorf("refresh timeout: %w", err)
+	}
+	if _, err := parseWindow(c.RefreshMinInterval); err != nil {
+		return fmt.Errorf("refresh min interval: %w", err)
+	}
+	if _, err := parseWindow(c.SnapshotMaxAge); err != nil {
+		return fmt.Errorf("snapshot max age: %w", err)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatText {
+		return fmt.Errorf("unknown log format %q", c.LogFormat)
+	}
+	if c.LeaderElection && c.LeaseName == "" {
+		return fmt.Errorf("leader election without lease name")
+	}
+	if c.LeaderElection && c.RefreshTokenFile == "" && c.TLSClientCAFile == "" {
+		return fmt.Errorf("leader election without refreshTokenFile or tlsClientCAFile authorizing the snapshot transfers")
+	}
+	if c.LeaderElection && c.SnapshotFile != "" {
+		return fmt.Errorf("leader election with a snapshot file, every replica reads the file")
+	}
+	if _, err := parseWindow(c.LeaseDuration); err != nil {
+		return fmt.Errorf("lease duration: %w", err)
+	}
+	if _, err := parseWindow(c.LeaderSyncInterval); err != nil {
+		return fmt.Errorf("leader sync interval: %w", err)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("TLS certificate and key are both required")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return fmt.Errorf("TLS client CA without TLS certificate")
+	}
+	if (c.LeaderTLSCAFile != "" || c.LeaderTLSServerName != "") && c.TLSCertFile == "" {
+		return fmt.Errorf("leader TLS CA or server name without TLS certificate")
+	}
+	if c.AWSMaxRetries < 0 {
+		return fmt.Errorf("invalid AWS max retries %d", c.AWSMaxRetries)
+	}
+	if c.AWSRateLimit <= 0 || c.AWSRateBurst < 1 {
+		return fmt.Errorf("invalid AWS rate limit %v with burst %d", c.AWSRateLimit, c.AWSRateBurst)
+	}
+	if c.CURSource != "" && c.CURDays < 1 {
+		return fmt.Errorf("invalid cost and usage report days %d", c.CURDays)
+	}
+	if c.CostExplorer && c.CostExplorerDays < 1 {
+		return fmt.Errorf("invalid cost explorer days %d", c.CostExplorerDays)
+	}
+	for _, name := range c.tagLabelNames() {
+		if !model.LabelName(name).IsValid() || instanceLabels[name] {
+			return fmt.Errorf("invalid instance tag label %q", name)
+		}
+	}
+
+	return c.validateCurrencies()
+}
+
+// RefreshDeadline returns the refresh timeout, 10 minutes when invalid.
+func (c Config) RefreshDeadline() time.Duration {
+	d, err := parseWindow(c.RefreshTimeout)
+	if err != nil {
+		return 10 * time.Minute
+	}
+
+	return d
+}
+
+// RefreshInterval returns the minimum time between two manual refreshes, 1 minute when invalid.
+func (c Config) RefreshInterval() time.Duration {
+	d, err := parseWindow(c.RefreshMinInterval)
+	if err != nil {
+		return time.Minute
+	}
+
+	return d
+}
+
+// SnapshotAgeLimit returns the age of the snapshot above which the exporter is not ready, 25 hours when invalid.
+func (c Config) SnapshotAgeLimit() time.Duration {
+	d, err := parseWindow(c.SnapshotMaxAge)
+	if err != nil {
+		return 25 * time.Hour
+	}
+
+	return d
+}
+
+// LoggingLevel returns the minimum level of the logs, info when invalid.
+func (c Config) LoggingLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// LeaseTTL returns how long a lease not renewed is held, 15 seconds when invalid.
+func (c Config) LeaseTTL() time.Duration {
+	d, err := parseWindow(c.LeaseDuration)
+	if err != nil {
+		return 15 * time.Second
+	}
+
+	return d
+}
+
+// LeaderSync returns how often the followers check the leader for a new snapshot, 1 minute when invalid.
+func (c Config) LeaderSync() time.Duration {
+	d, err := parseWindow(c.LeaderSyncInterval)
+	if err != nil {
+		return time.Minute
+	}
+
+	return d
+}
+
+// tagLabelNames returns the sorted label names of the instance tags.
+func (c Config) tagLabelNames() []string {
+	names := []string{}
+	for name, key := range c.InstanceTagLabels {
+		if key != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// tagKeys returns the EC2 tag keys exported as labels.
+func (c Config) tagKeys() []string {
+	keys := []string{}
+	for _, name := range c.tagLabelNames() {
+		keys = append(keys, c.InstanceTagLabels[name])
+	}
+
+	return keys
+}
+
+// parseWindow parses a duration accepting the day suffix "d" on top of time.ParseDuration.
+func parseWindow(window string) (time.Duration, error) {
+	if days := strings.TrimSuffix(window, "d"); days != window {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", window)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+
+	return d, nil
+}
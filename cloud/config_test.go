@@ -0,0 +1,135 @@
+package cloud
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "Test hours", window: "1h", want: time.Hour},
+		{name: "Test days", window: "7d", want: 7 * 24 * time.Hour},
+		{name: "Test invalid days", window: "xd", wantErr: true},
+		{name: "Test negative", window: "-1h", wantErr: true},
+		{name: "Test unknown unit", window: "1y", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWindow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	noSchema := DefaultConfig()
+	noSchema.LabelSchemas = nil
+	karpenter := DefaultConfig()
+	karpenter.LabelSchemas = append(karpenter.LabelSchemas, LabelSchema{
+		InstanceType: "node.kubernetes.io/instance-type",
+		CapacityType: "karpenter.sh/capacity-type",
+		Zone:         "topology.kubernetes.io/zone",
+	})
+	unknownCapacity := DefaultConfig()
+	unknownCapacity.LabelSchemas[0].CapacityTypeValues = map[string]string{"spot": "spot"}
+	reservedTag := DefaultConfig()
+	reservedTag.InstanceTagLabels["az"] = "Zone"
+	invalidTag := DefaultConfig()
+	invalidTag.InstanceTagLabels["cost-center"] = "CostCenter"
+	staticEUR := DefaultConfig()
+	staticEUR.Currencies = []string{"EUR", "USD"}
+	staticEUR.CurrencyRates = map[string]float64{"EUR": 0.92}
+	noRate := DefaultConfig()
+	noRate.Currencies = []string{"GBP"}
+	invalidCurrency := DefaultConfig()
+	invalidCurrency.Currencies = []string{"euro"}
+	invalidCurrency.CurrencyRateSource = "eurofxref-daily.xml"
+	noRefreshTimeout := DefaultConfig()
+	noRefreshTimeout.RefreshTimeout = "0s"
+	leaderElection := DefaultConfig()
+	leaderElection.LeaderElection = true
+	leaderElection.RefreshTokenFile = "token"
+	leaderWithoutAuth := leaderElection
+	leaderWithoutAuth.RefreshTokenFile = ""
+	noLeaseName := leaderElection
+	noLeaseName.LeaseName = ""
+	leaderSnapshotFile := leaderElection
+	leaderSnapshotFile.SnapshotFile = "snapshot.json.gz"
+	noLeaseDuration := DefaultConfig()
+	noLeaseDuration.LeaseDuration = "15"
+	debugText := DefaultConfig()
+	debugText.LogLevel, debugText.LogFormat = "debug", LogFormatText
+	unknownLevel := DefaultConfig()
+	unknownLevel.LogLevel = "verbose"
+	unknownFormat := DefaultConfig()
+	unknownFormat.LogFormat = "logfmt"
+	noMaxAge := DefaultConfig()
+	noMaxAge.SnapshotMaxAge = ""
+	noRefreshInterval := DefaultConfig()
+	noRefreshInterval.RefreshMinInterval = "1x"
+	keyWithoutCert := DefaultConfig()
+	keyWithoutCert.TLSKeyFile = "tls.key"
+	clientCAWithoutCert := DefaultConfig()
+	clientCAWithoutCert.TLSClientCAFile = "ca.crt"
+	leaderTLS := leaderElection
+	leaderTLS.TLSCertFile, leaderTLS.TLSKeyFile = "tls.crt", "tls.key"
+	leaderTLS.LeaderTLSCAFile, leaderTLS.LeaderTLSServerName = "ca.crt", "cost-report.monitoring.svc"
+	leaderServerNameWithoutCert := leaderElection
+	leaderServerNameWithoutCert.LeaderTLSServerName = "cost-report.monitoring.svc"
+	noRateLimit := DefaultConfig()
+	noRateLimit.AWSRateBurst = 0
+	incomplete := DefaultConfig()
+	incomplete.LabelSchemas = []LabelSchema{{InstanceType: "node.kubernetes.io/instance-type"}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "Test default config", cfg: DefaultConfig()},
+		{name: "Test unknown stat", cfg: Config{SpotStats: []string{"p99"}}, wantErr: true},
+		{name: "Test invalid window", cfg: Config{SpotWindows: []string{"0h"}}, wantErr: true},
+		{name: "Test multiple label schemas", cfg: karpenter},
+		{name: "Test no label schema", cfg: noSchema, wantErr: true},
+		{name: "Test incomplete label schema", cfg: incomplete, wantErr: true},
+		{name: "Test unknown capacity type value mapping", cfg: unknownCapacity, wantErr: true},
+		{name: "Test reserved instance tag label", cfg: reservedTag, wantErr: true},
+		{name: "Test invalid instance tag label", cfg: invalidTag, wantErr: true},
+		{name: "Test static currency rates", cfg: staticEUR},
+		{name: "Test currency without rate", cfg: noRate, wantErr: true},
+		{name: "Test invalid currency", cfg: invalidCurrency, wantErr: true},
+		{name: "Test AWS rate limit without burst", cfg: noRateLimit, wantErr: true},
+		{name: "Test invalid refresh timeout", cfg: noRefreshTimeout, wantErr: true},
+		{name: "Test invalid refresh interval", cfg: noRefreshInterval, wantErr: true},
+		{name: "Test invalid snapshot max age", cfg: noMaxAge, wantErr: true},
+		{name: "Test debug text logs", cfg: debugText},
+		{name: "Test leader election", cfg: leaderElection},
+		{name: "Test leader election without lease name", cfg: noLeaseName, wantErr: true},
+		{name: "Test leader election without authorization", cfg: leaderWithoutAuth, wantErr: true},
+		{name: "Test leader election with snapshot file", cfg: leaderSnapshotFile, wantErr: true},
+		{name: "Test invalid lease duration", cfg: noLeaseDuration, wantErr: true},
+		{name: "Test unknown log level", cfg: unknownLevel, wantErr: true},
+		{name: "Test unknown log format", cfg: unknownFormat, wantErr: true},
+		{name: "Test TLS key without certificate", cfg: keyWithoutCert, wantErr: true},
+		{name: "Test client CA without certificate", cfg: clientCAWithoutCert, wantErr: true},
+		{name: "Test leader election over TLS", cfg: leaderTLS},
+		{name: "Test leader server name without certificate", cfg: leaderServerNameWithoutCert, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
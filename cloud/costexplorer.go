@@ -0,0 +1,158 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const costExplorerMetric = "UnblendedCost"
+
+// DailyCost is the actual spend of a day from Cost Explorer, grouped by service and usage type or cost allocation tag.
+type DailyCost struct {
+	// AccountID is the account Cost Explorer was queried with.
+	AccountID string
+	Date      string
+	Service   string
+	UsageType string
+	TagKey    string
+	TagValue  string
+	Cost      float64
+}
+
+// costAndUsage queries the daily cost between start and end, both dates, grouped by service and the second dimension.
+func costAndUsage(ctx context.Context, svc costexploreriface.CostExplorerAPI, start, end string, groupBy *costexplorer.GroupDefinition) ([]DailyCost, error) {
+	input := &costexplorer.GetCostAndUsageInput{
+		Granularity: aws.String(costexplorer.GranularityDaily),
+		Metrics:     aws.StringSlice([]string{costExplorerMetric}),
+		TimePeriod:  &costexplorer.DateInterval{Start: aws.String(start), End: aws.String(end)},
+		GroupBy: []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(costexplorer.DimensionService)},
+			groupBy,
+		},
+	}
+
+	result := []DailyCost{}
+	for {
+		output, err := svc.GetCostAndUsageWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("getCostAndUsage: %w", err)
+		}
+		for _, period := range output.ResultsByTime {
+			for _, group := range period.Groups {
+				keys := aws.StringValueSlice(group.Keys)
+				metric, ok := group.Metrics[costExplorerMetric]
+				if len(keys) != 2 || !ok {
+					continue
+				}
+				cost, err := strconv.ParseFloat(aws.StringValue(metric.Amount), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cost %q: %w", aws.StringValue(metric.Amount), err)
+				}
+				daily := DailyCost{Date: aws.StringValue(period.TimePeriod.Start), Service: keys[0], Cost: cost}
+				if aws.StringValue(groupBy.Type) == costexplorer.GroupDefinitionTypeTag {
+					// The tag groups are keyed tag$value.
+					daily.TagKey, daily.TagValue, _ = strings.Cut(keys[1], "$")
+				} else {
+					daily.UsageType = keys[1]
+				}
+				result = append(result, daily)
+			}
+		}
+		if output.NextPageToken == nil {
+			return result, nil
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+}
+
+// dailyCosts queries the daily cost of the last days grouped by service and usage type, then by service and every tag.
+// The queries failing are skipped with a partial error.
+func dailyCosts(ctx context.Context, svc costexploreriface.CostExplorerAPI, tags []string, days int, now time.Time) ([]DailyCost, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, 1-days).Format(dateLayout)
+	// The end date is exclusive, so the current day is included.
+	end := today.AddDate(0, 0, 1).Format(dateLayout)
+
+	errs := []error{}
+	result, err := costAndUsage(ctx, svc, start, end, &costexplorer.GroupDefinition{
+		Type: aws.String(costexplorer.GroupDefinitionTypeDimension),
+		Key:  aws.String(costexplorer.DimensionUsageType),
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, tag := range tags {
+		costs, err := costAndUsage(ctx, svc, start, end, &costexplorer.GroupDefinition{
+			Type: aws.String(costexplorer.GroupDefinitionTypeTag),
+			Key:  aws.String(tag),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tag %s: %w", tag, err))
+
+			continue
+		}
+		result = append(result, costs...)
+	}
+	if len(errs) == len(tags)+1 {
+		return nil, joinPartial("GetCostAndUsage", errs)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+
+	return result, joinPartial("GetCostAndUsage", errs)
+}
+
+// CostExplorerMetric returns the daily spend of the first account of the config from Cost Explorer.
+// The queries failing are skipped with a partial error.
+func CostExplorerMetric(ctx context.Context, cfg Config, now time.Time) ([]DailyCost, error) {
+	ses, err := cfg.Accounts[0].session()
+	if err != nil {
+		return nil, err
+	}
+	accountID, err := callerAccount(ctx, ses)
+	if err != nil {
+		return nil, fmt.Errorf("cost explorer: getCallerIdentity: %w", err)
+	}
+	// Cost Explorer is only served from us-east-1.
+	svc := costexplorer.New(ses, aws.NewConfig().WithRegion("us-east-1"))
+	costs, err := dailyCosts(ctx, svc, cfg.CostExplorerTags, cfg.CostExplorerDays, now)
+	for i := range costs {
+		costs[i].AccountID = accountID
+	}
+	if err != nil {
+		return costs, fmt.Errorf("cost explorer: %w", err)
+	}
+
+	return costs, nil
+}
+
+// dailyCostCalc sets the daily spend per service and usage type, and per service and tag value.
+func dailyCostCalc(costs []DailyCost, usageCost, tagCost *prometheus.GaugeVec) {
+	for _, cost := range costs {
+		if cost.TagKey != "" {
+			tagCost.With(prometheus.Labels{
+				AccountID: cost.AccountID,
+				"service": cost.Service,
+				"tag":     cost.TagKey,
+				"value":   cost.TagValue,
+				Date:      cost.Date,
+			}).Set(cost.Cost)
+
+			continue
+		}
+		usageCost.With(prometheus.Labels{
+			AccountID:    cost.AccountID,
+			"service":    cost.Service,
+			"usage_type": cost.UsageType,
+			Date:         cost.Date,
+		}).Set(cost.Cost)
+	}
+}
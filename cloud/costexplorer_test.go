@@ -0,0 +1,116 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+	"github.com/aws/aws-sdk-go/service/costexplorer/costexploreriface"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeCostExplorer serves one page per group for the usage types, and a single page for the tags.
+type fakeCostExplorer struct {
+	costexploreriface.CostExplorerAPI
+	inputs  []*costexplorer.GetCostAndUsageInput
+	failing string
+}
+
+func costGroup(cost string, keys ...string) *costexplorer.Group {
+	return &costexplorer.Group{
+		Keys:    aws.StringSlice(keys),
+		Metrics: map[string]*costexplorer.MetricValue{costExplorerMetric: {Amount: aws.String(cost), Unit: aws.String("USD")}},
+	}
+}
+
+func (f *fakeCostExplorer) GetCostAndUsageWithContext(_ aws.Context, input *costexplorer.GetCostAndUsageInput, _ ...request.Option) (*costexplorer.GetCostAndUsageOutput, error) {
+	copied := *input
+	f.inputs = append(f.inputs, &copied)
+	if aws.StringValue(input.GroupBy[1].Key) == f.failing {
+		return nil, errors.New("tag not activated")
+	}
+	period := &costexplorer.DateInterval{Start: aws.String("2022-10-10"), End: aws.String("2022-10-11")}
+	if aws.StringValue(input.GroupBy[1].Type) == costexplorer.GroupDefinitionTypeTag {
+		return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []*costexplorer.ResultByTime{{
+			TimePeriod: period,
+			Groups:     []*costexplorer.Group{costGroup("3.5", "Amazon Elastic Compute Cloud - Compute", "team$payments")},
+		}}}, nil
+	}
+	if input.NextPageToken == nil {
+		return &costexplorer.GetCostAndUsageOutput{
+			NextPageToken: aws.String("next"),
+			ResultsByTime: []*costexplorer.ResultByTime{{
+				TimePeriod: period,
+				Groups:     []*costexplorer.Group{costGroup("10.25", "Amazon Elastic Compute Cloud - Compute", "EU-BoxUsage:m5.large")},
+			}},
+		}, nil
+	}
+
+	return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []*costexplorer.ResultByTime{{
+		TimePeriod: period,
+		Groups:     []*costexplorer.Group{costGroup("1", "Amazon Simple Storage Service", "EU-TimedStorage-ByteHrs")},
+	}}}, nil
+}
+
+func Test_dailyCosts(t *testing.T) {
+	svc := &fakeCostExplorer{}
+	got, err := dailyCosts(context.Background(), svc, []string{"team"}, 7, time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("dailyCosts() error = %v", err)
+	}
+	want := []DailyCost{
+		{Date: "2022-10-10", Service: "Amazon Elastic Compute Cloud - Compute", UsageType: "EU-BoxUsage:m5.large", Cost: 10.25},
+		{Date: "2022-10-10", Service: "Amazon Simple Storage Service", UsageType: "EU-TimedStorage-ByteHrs", Cost: 1},
+		{Date: "2022-10-10", Service: "Amazon Elastic Compute Cloud - Compute", TagKey: "team", TagValue: "payments", Cost: 3.5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dailyCosts() = %v, want %v", got, want)
+	}
+	period := svc.inputs[0].TimePeriod
+	if aws.StringValue(period.Start) != "2022-10-04" || aws.StringValue(period.End) != "2022-10-11" {
+		t.Errorf("dailyCosts() period = %v, want 2022-10-04 to 2022-10-11", period)
+	}
+	if len(svc.inputs) != 3 {
+		t.Errorf("dailyCosts() queries = %d, want 3", len(svc.inputs))
+	}
+
+	svc = &fakeCostExplorer{failing: "env"}
+	got, err = dailyCosts(context.Background(), svc, []string{"env", "team"}, 7, time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC))
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Skipped != 1 {
+		t.Errorf("dailyCosts() error = %v, want a partial error skipping the env tag", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dailyCosts() = %v, want %v", got, want)
+	}
+}
+
+func Test_dailyCostCalc(t *testing.T) {
+	usageCost := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "aws_daily_cost", Help: "Cost"},
+		[]string{AccountID, "service", "usage_type", Date})
+	tagCost := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "aws_daily_tag_cost", Help: "Cost"},
+		[]string{AccountID, "service", "tag", "value", Date})
+	dailyCostCalc([]DailyCost{
+		{AccountID: "222", Date: "2022-10-10", Service: "Amazon EC2", UsageType: "BoxUsage:m5.large", Cost: 2.5},
+		{AccountID: "222", Date: "2022-10-10", Service: "Amazon EC2", TagKey: "team", TagValue: "data", Cost: 1},
+	}, usageCost, tagCost)
+
+	want := `
+# HELP aws_daily_cost Cost
+# TYPE aws_daily_cost gauge
+aws_daily_cost{account_id="222",date="2022-10-10",service="Amazon EC2",usage_type="BoxUsage:m5.large"} 2.5
+`
+	if err := testutil.CollectAndCompare(usageCost, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(tagCost.WithLabelValues("222", "Amazon EC2", "team", "data", "2022-10-10")); got != 1 {
+		t.Errorf("dailyCostCalc() tag cost = %v, want 1", got)
+	}
+}
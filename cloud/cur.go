@@ -0,0 +1,652 @@
+package cloud
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Date label.
+	Date       = "date"
+	dateLayout = "2006-01-02"
+	curRowsBuf = 1024
+	// curPeriodLayout is the layout of the billing period bounds of the report manifests, e.g. 20221001T000000.000Z.
+	curPeriodLayout = "20060102T150405.000Z"
+)
+
+// curPeriodFolder matches the billing period folders of the reports, e.g. 20221001-20221101.
+var curPeriodFolder = regexp.MustCompile(`^[0-9]{8}-[0-9]{8}$`)
+
+// CURUsage is the EC2 usage and cost of an instance type in an AZ on a day from the Cost and Usage Report.
+type CURUsage struct {
+	AccountID    string
+	InstanceType string
+	CapacityType string
+	AZ           string
+	Date         string
+	Hours        float64
+	Cost         float64
+}
+
+// curRecord is a line item of the report with the columns used for the reconciliation.
+type curRecord map[string]string
+
+// curColumn normalizes the column names of the CSV and Parquet reports,
+// e.g. lineItem/UsageStartDate and line_item_usage_start_date are both line_item_usage_start_date.
+func curColumn(name string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range name {
+		switch {
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			b.WriteRune('_')
+			b.WriteRune(unicode.ToLower(r))
+		case r == '/':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(unicode.ToLower(r))
+		}
+		prev = r
+	}
+
+	return b.String()
+}
+
+// usageCost returns the cost actually billed for the line item, the effective cost of the reservations and savings plans.
+func (r curRecord) usageCost() (float64, error) {
+	column := "line_item_unblended_cost"
+	switch r["line_item_line_item_type"] {
+	case "DiscountedUsage":
+		column = "reservation_effective_cost"
+	case "SavingsPlanCoveredUsage":
+		column = "savings_plan_savings_plan_effective_cost"
+	}
+
+	return strconv.ParseFloat(r[column], 64)
+}
+
+func parseCURTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04Z"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid usage start date %q", value)
+}
+
+// curAggregator sums the instance usage line items since a day per account, instance type, capacity type, AZ and day.
+type curAggregator struct {
+	since time.Time
+	usage map[CURUsage]*CURUsage
+}
+
+func newCURAggregator(since time.Time) *curAggregator {
+	return &curAggregator{since: since, usage: map[CURUsage]*CURUsage{}}
+}
+
+// add adds the line item when it is the usage of an EC2 instance.
+func (a *curAggregator) add(r curRecord) error {
+	usageType := r["line_item_usage_type"]
+	if r["line_item_product_code"] != "AmazonEC2" || r["product_instance_type"] == "" ||
+		(!strings.Contains(usageType, "BoxUsage") && !strings.Contains(usageType, "SpotUsage")) {
+		return nil
+	}
+	switch r["line_item_line_item_type"] {
+	case "Usage", "DiscountedUsage", "SavingsPlanCoveredUsage":
+	default:
+		return nil
+	}
+
+	start, err := parseCURTime(r["line_item_usage_start_date"])
+	if err != nil {
+		return err
+	}
+	if start.Before(a.since) {
+		return nil
+	}
+	hours, err := strconv.ParseFloat(r["line_item_usage_amount"], 64)
+	if err != nil {
+		return fmt.Errorf("invalid usage amount %q: %w", r["line_item_usage_amount"], err)
+	}
+	cost, err := r.usageCost()
+	if err != nil {
+		return fmt.Errorf("invalid cost: %w", err)
+	}
+
+	capacityType := CapacityOnDemand
+	if strings.Contains(usageType, "SpotUsage") {
+		capacityType = CapacitySpot
+	}
+	key := CURUsage{
+		AccountID:    r["line_item_usage_account_id"],
+		InstanceType: r["product_instance_type"],
+		CapacityType: capacityType,
+		AZ:           r["line_item_availability_zone"],
+		Date:         start.UTC().Format(dateLayout),
+	}
+	usage := a.entry(key)
+	usage.Hours += hours
+	usage.Cost += cost
+
+	return nil
+}
+
+// entry returns the usage of the key, added when missing.
+func (a *curAggregator) entry(key CURUsage) *CURUsage {
+	usage, ok := a.usage[key]
+	if !ok {
+		value := key
+		usage = &value
+		a.usage[key] = usage
+	}
+
+	return usage
+}
+
+// addFile adds the line items of a report file read with the read function once it is read entirely,
+// so a file failing midway adds none.
+func (a *curAggregator) addFile(read func(add func(curRecord) error) error) error {
+	file := newCURAggregator(a.since)
+	if err := read(file.add); err != nil {
+		return err
+	}
+	for key, usage := range file.usage {
+		total := a.entry(key)
+		total.Hours += usage.Hours
+		total.Cost += usage.Cost
+	}
+
+	return nil
+}
+
+func (a *curAggregator) result() []CURUsage {
+	result := make([]CURUsage, 0, len(a.usage))
+	for _, usage := range a.usage {
+		result = append(result, *usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		x, y := result[i], result[j]
+		if x.Date != y.Date {
+			return x.Date < y.Date
+		}
+		if x.AccountID != y.AccountID {
+			return x.AccountID < y.AccountID
+		}
+		if x.InstanceType != y.InstanceType {
+			return x.InstanceType < y.InstanceType
+		}
+		if x.CapacityType != y.CapacityType {
+			return x.CapacityType < y.CapacityType
+		}
+
+		return x.AZ < y.AZ
+	})
+
+	return result
+}
+
+// parseCURCSV adds the line items of a CSV report.
+func parseCURCSV(reader io.Reader, add func(curRecord) error) error {
+	r := csv.NewReader(reader)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = curColumn(name)
+	}
+
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read line item: %w", err)
+		}
+		record := curRecord{}
+		for i, value := range row {
+			record[columns[i]] = value
+		}
+		if err := add(record); err != nil {
+			return err
+		}
+	}
+}
+
+// parquetString formats a Parquet value like the CSV reports, the timestamps in RFC 3339.
+func parquetString(value parquet.Value, node parquet.Node) string {
+	if value.IsNull() {
+		return ""
+	}
+	switch value.Kind() {
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(value.ByteArray())
+	case parquet.Double:
+		return strconv.FormatFloat(value.Double(), 'f', -1, 64)
+	case parquet.Float:
+		return strconv.FormatFloat(float64(value.Float()), 'f', -1, 32)
+	case parquet.Int64:
+		if logical := node.Type().LogicalType(); logical != nil && logical.Timestamp != nil {
+			unit := logical.Timestamp.Unit
+			switch {
+			case unit.Nanos != nil:
+				return time.Unix(0, value.Int64()).UTC().Format(time.RFC3339)
+			case unit.Micros != nil:
+				return time.UnixMicro(value.Int64()).UTC().Format(time.RFC3339)
+			default:
+				return time.UnixMilli(value.Int64()).UTC().Format(time.RFC3339)
+			}
+		}
+	}
+
+	return value.String()
+}
+
+// parseCURParquet adds the line items of a Parquet report.
+func parseCURParquet(reader io.ReaderAt, size int64, add func(curRecord) error) error {
+	file, err := parquet.OpenFile(reader, size)
+	if err != nil {
+		return fmt.Errorf("open parquet: %w", err)
+	}
+	schema := file.Schema()
+	paths := schema.Columns()
+	columns := make([]string, len(paths))
+	nodes := make([]parquet.Node, len(paths))
+	for _, path := range paths {
+		leaf, _ := schema.Lookup(path...)
+		columns[leaf.ColumnIndex] = curColumn(strings.Join(path, "_"))
+		nodes[leaf.ColumnIndex] = leaf.Node
+	}
+
+	rows := parquet.NewReader(file)
+	defer rows.Close()
+	buf := make([]parquet.Row, curRowsBuf)
+	for {
+		n, err := rows.ReadRows(buf)
+		for _, row := range buf[:n] {
+			record := curRecord{}
+			for _, value := range row {
+				column := value.Column()
+				record[columns[column]] = parquetString(value, nodes[column])
+			}
+			if err := add(record); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read line items: %w", err)
+		}
+	}
+}
+
+// isCURFile returns whether the file is a CSV, gzipped CSV or Parquet report.
+func isCURFile(name string) bool {
+	return strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".csv.gz") || strings.HasSuffix(name, ".parquet")
+}
+
+// parseCURParquetStream adds the line items of a Parquet report read from a stream, spooled to a temporary file
+// as Parquet needs random access.
+func parseCURParquetStream(reader io.Reader, add func(curRecord) error) error {
+	if file, ok := reader.(*os.File); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+
+		return parseCURParquet(file, info.Size(), add)
+	}
+
+	tmp, err := os.CreateTemp("", "cur-*.parquet")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return fmt.Errorf("copy to temporary file: %w", err)
+	}
+
+	return parseCURParquet(tmp, size, add)
+}
+
+// parseCURFile adds the line items of the report file in the format of its extension.
+func parseCURFile(name string, reader io.Reader, add func(curRecord) error) error {
+	switch {
+	case strings.HasSuffix(name, ".parquet"):
+		return parseCURParquetStream(reader, add)
+	case strings.HasSuffix(name, ".gz"):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("gunzip %s: %w", name, err)
+		}
+		defer gz.Close()
+
+		return parseCURCSV(gz, add)
+	default:
+		return parseCURCSV(reader, add)
+	}
+}
+
+// readLocalCUR adds the line items of the report file or of the report files in the directory, a local copy of the
+// report prefix selected like readS3CUR with the manifests of the billing periods.
+// The periods and files failing are skipped with a partial error.
+func readLocalCUR(ctx context.Context, path string, aggregator *curAggregator) error {
+	manifests, files := []string{}, []string{}
+	err := filepath.WalkDir(path, func(name string, entry fs.DirEntry, err error) error {
+		switch {
+		case err != nil || entry.IsDir():
+			return err
+		case isCURManifest(filepath.ToSlash(name)):
+			manifests = append(manifests, name)
+		case isCURFile(name):
+			files = append(files, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	if len(manifests) > 0 {
+		files = []string{}
+		for _, name := range manifests {
+			manifest, err := readLocalCURManifest(name)
+			if err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+			current, err := manifest.endsAfter(aggregator.since)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+
+				continue
+			}
+			if !current {
+				continue
+			}
+			for _, key := range manifest.ReportKeys {
+				file, err := localCURFile(name, key)
+				if err != nil {
+					errs = append(errs, err)
+
+					continue
+				}
+				files = append(files, file)
+			}
+		}
+	}
+
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := aggregator.addFile(func(add func(curRecord) error) error { return readLocalCURFile(name, add) }); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return joinPartial(collectorCUR, errs)
+}
+
+// readLocalCURManifest reads the manifest of a billing period.
+func readLocalCURManifest(name string) (curManifest, error) {
+	manifest := curManifest{}
+	data, err := os.ReadFile(name) // #nosec G304 -- the path comes from the exporter config
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("decode %s: %w", name, err)
+	}
+
+	return manifest, nil
+}
+
+// localCURFile returns the local file of the report key of the manifest, the key being relative to the bucket while
+// the copy keeps the files of the billing period under the folder of its manifest.
+func localCURFile(manifest, key string) (string, error) {
+	dir := filepath.Dir(manifest)
+	_, rest, ok := strings.Cut(key, "/"+filepath.Base(dir)+"/")
+	if !ok {
+		return "", fmt.Errorf("%s: report key %s outside of the billing period", manifest, key)
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(rest)), nil
+}
+
+// readLocalCURFile adds the line items of a report file.
+func readLocalCURFile(name string, add func(curRecord) error) error {
+	file, err := os.Open(name) // #nosec G304 -- the path comes from the exporter config
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return parseCURFile(name, file, add)
+}
+
+// curManifest is the manifest of a billing period of a legacy report, listing the files of its latest version.
+type curManifest struct {
+	ReportKeys    []string `json:"reportKeys"`
+	BillingPeriod struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"billingPeriod"`
+}
+
+// endsAfter returns whether the billing period of the manifest ends after the time.
+func (m curManifest) endsAfter(t time.Time) (bool, error) {
+	end, err := time.Parse(curPeriodLayout, m.BillingPeriod.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid billing period end: %w", err)
+	}
+
+	return end.After(t), nil
+}
+
+// isCURManifest returns whether the key is the manifest of a billing period, and not one of the copies in the
+// assembly folders of the period.
+func isCURManifest(key string) bool {
+	return strings.HasSuffix(key, "-Manifest.json") && curPeriodFolder.MatchString(path.Base(path.Dir(key)))
+}
+
+// readS3CUR adds the line items of the reports under the prefix of the bucket for the billing periods ending after
+// the aggregator start. Every version of a legacy report is a full copy in its own assembly folder, so only the files
+// listed in the manifest of each period are read. The files under the prefix are all read when there is no manifest,
+// e.g. for CUR 2.0 exports overwritten in place. The periods and files failing are skipped with a partial error.
+func readS3CUR(ctx context.Context, svc s3iface.S3API, bucket, prefix string, aggregator *curAggregator) error {
+	manifests, files := []string{}, []string{}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	err := svc.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			switch {
+			case isCURManifest(key):
+				manifests = append(manifests, key)
+			case isCURFile(key):
+				files = append(files, key)
+			}
+		}
+
+		return !lastPage
+	})
+	if err != nil {
+		return fmt.Errorf("listObjects s3://%s/%s: %w", bucket, prefix, err)
+	}
+
+	errs := []error{}
+	keys := files
+	if len(manifests) > 0 {
+		keys = []string{}
+		for _, key := range manifests {
+			manifest, err := readS3CURManifest(ctx, svc, bucket, key)
+			if err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+			current, err := manifest.endsAfter(aggregator.since)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("s3://%s/%s: %w", bucket, key, err))
+
+				continue
+			}
+			if !current {
+				continue
+			}
+			keys = append(keys, manifest.ReportKeys...)
+		}
+	}
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := aggregator.addFile(func(add func(curRecord) error) error { return readS3CURFile(ctx, svc, bucket, key, add) })
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return joinPartial(collectorCUR, errs)
+}
+
+// readS3CURManifest reads the manifest of a billing period.
+func readS3CURManifest(ctx context.Context, svc s3iface.S3API, bucket, key string) (curManifest, error) {
+	manifest := curManifest{}
+	object, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return manifest, fmt.Errorf("getObject s3://%s/%s: %w", bucket, key, err)
+	}
+	defer object.Body.Close()
+	if err := json.NewDecoder(object.Body).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("decode s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return manifest, nil
+}
+
+// readS3CURFile adds the line items of a report file.
+func readS3CURFile(ctx context.Context, svc s3iface.S3API, bucket, key string, add func(curRecord) error) error {
+	object, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("getObject s3://%s/%s: %w", bucket, key, err)
+	}
+	defer object.Body.Close()
+	if err := parseCURFile(key, object.Body, add); err != nil {
+		return fmt.Errorf("s3://%s/%s: %w", bucket, key, err)
+	}
+
+	return nil
+}
+
+// CURMetric returns the EC2 instance usage of the last days from the Cost and Usage Report files of the config.
+// The report files failing are skipped with a partial error.
+func CURMetric(ctx context.Context, cfg Config, now time.Time) ([]CURUsage, error) {
+	aggregator := newCURAggregator(now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-cfg.CURDays))
+	err := readCUR(ctx, cfg, aggregator)
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, fmt.Errorf("cost and usage report: %w", err)
+	}
+
+	return aggregator.result(), err
+}
+
+// readCUR adds the line items of the local or S3 report files of the config.
+func readCUR(ctx context.Context, cfg Config, aggregator *curAggregator) error {
+	location, isS3 := strings.CutPrefix(cfg.CURSource, "s3://")
+	if !isS3 {
+		return readLocalCUR(ctx, cfg.CURSource, aggregator)
+	}
+
+	bucket, prefix, _ := strings.Cut(location, "/")
+	awsCfg := aws.NewConfig().WithRegion("eu-west-1")
+	if cfg.CUREndpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.CUREndpoint).WithS3ForcePathStyle(true)
+	}
+	ses, err := newSession(awsCfg)
+	if err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+
+	return readS3CUR(ctx, s3.New(ses), bucket, prefix, aggregator)
+}
+
+// curKey identifies the reconciled cost of an instance type on a day.
+type curKey struct {
+	AccountID    string
+	InstanceType string
+	CapacityType string
+	Date         string
+}
+
+// curCalc sets the actual cost of the report, the cost estimated from the usage hours with the snapshot prices
+// and their ratio, per account, instance type, capacity type and day. The estimate and the ratio are only set when
+// the usage of every AZ has a price, so the ratio compares the same usage.
+func curCalc(s *Snapshot, actualCost, estimatedCost, ratio *prometheus.GaugeVec) {
+	actual := map[curKey]float64{}
+	estimated := map[curKey]float64{}
+	unpriced := map[curKey]bool{}
+	for _, usage := range s.CURUsage {
+		key := curKey{AccountID: usage.AccountID, InstanceType: usage.InstanceType, CapacityType: usage.CapacityType, Date: usage.Date}
+		actual[key] += usage.Cost
+		price, ok := s.AccountHourlyPrice(usage.AccountID, usage.InstanceType, usage.CapacityType, usage.AZ)
+		if !ok {
+			// The accounts not collected are estimated with the spot prices of the snapshot account.
+			price, ok = s.HourlyPrice(usage.InstanceType, usage.CapacityType, usage.AZ)
+		}
+		if !ok {
+			unpriced[key] = true
+
+			continue
+		}
+		estimated[key] += usage.Hours * price
+	}
+
+	for key, cost := range actual {
+		labels := prometheus.Labels{
+			AccountID:       key.AccountID,
+			"instance_type": key.InstanceType,
+			"capacity_type": key.CapacityType,
+			Date:            key.Date,
+		}
+		actualCost.With(labels).Set(cost)
+		if estimate := estimated[key]; estimate > 0 && !unpriced[key] {
+			estimatedCost.With(labels).Set(estimate)
+			ratio.With(labels).Set(cost / estimate)
+		}
+	}
+}
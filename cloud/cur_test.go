@@ -0,0 +1,304 @@
+package cloud
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const curCSVSample = `identity/LineItemId,lineItem/UsageAccountId,lineItem/LineItemType,lineItem/UsageStartDate,lineItem/ProductCode,lineItem/UsageType,lineItem/AvailabilityZone,lineItem/UsageAmount,lineItem/UnblendedCost,product/instanceType,reservation/EffectiveCost,savingsPlan/SavingsPlanEffectiveCost
+1,111,Usage,2022-10-10T00:00:00Z,AmazonEC2,EU-BoxUsage:m5.large,eu-west-1a,1,0.1,m5.large,,
+2,111,SavingsPlanCoveredUsage,2022-10-10T01:00:00Z,AmazonEC2,EU-BoxUsage:m5.large,eu-west-1a,1,0.1,m5.large,,0.06
+3,111,Usage,2022-10-10T00:00:00Z,AmazonEC2,EU-SpotUsage:m5.large,eu-west-1b,2,0.08,m5.large,,
+4,111,Usage,2022-10-10T00:00:00Z,AmazonEC2,EU-EBS:VolumeUsage.gp3,,10,1,,,
+5,111,Usage,2022-10-01T00:00:00Z,AmazonEC2,EU-BoxUsage:m5.large,eu-west-1a,1,0.1,m5.large,,
+`
+
+func Test_curColumn(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "lineItem/UsageStartDate", want: "line_item_usage_start_date"},
+		{name: "line_item_usage_start_date", want: "line_item_usage_start_date"},
+		{name: "savingsPlan/SavingsPlanEffectiveCost", want: "savings_plan_savings_plan_effective_cost"},
+		{name: "lineItem/UsageAccountId", want: "line_item_usage_account_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := curColumn(tt.name); got != tt.want {
+				t.Errorf("curColumn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+var curSampleUsage = []CURUsage{
+	{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacityOnDemand, AZ: "eu-west-1a", Date: "2022-10-10", Hours: 2, Cost: 0.16},
+	{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacitySpot, AZ: "eu-west-1b", Date: "2022-10-10", Hours: 2, Cost: 0.08},
+}
+
+func TestCURMetricCSV(t *testing.T) {
+	dir := t.TempDir()
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write([]byte(curCSVSample)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := os.WriteFile(filepath.Join(dir, "report-00001.csv.gz"), gz.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Manifest.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.CURSource = dir
+	got, err := CURMetric(context.Background(), cfg, time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("CURMetric() error = %v", err)
+	}
+	if len(got) != len(curSampleUsage) {
+		t.Fatalf("CURMetric() = %v, want %v", got, curSampleUsage)
+	}
+	for i := range got {
+		if !curUsageEqual(got[i], curSampleUsage[i]) {
+			t.Errorf("CURMetric() = %v, want %v", got[i], curSampleUsage[i])
+		}
+	}
+}
+
+// fakeCURS3 serves the objects of a bucket and records the keys read.
+type fakeCURS3 struct {
+	s3iface.S3API
+	objects map[string]string
+	read    []string
+}
+
+func (f *fakeCURS3) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	page := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(page, true)
+
+	return nil
+}
+
+func (f *fakeCURS3) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	body, ok := f.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("no such key %s", key)
+	}
+	f.read = append(f.read, key)
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func Test_readS3CUR(t *testing.T) {
+	manifest := func(start, end, key string) string {
+		return fmt.Sprintf(`{"reportKeys":[%q],"billingPeriod":{"start":%q,"end":%q}}`, key, start, end)
+	}
+	svc := &fakeCURS3{objects: map[string]string{
+		"cur/eks-cost/20220901-20221001/eks-cost-Manifest.json":   manifest("20220901T000000.000Z", "20221001T000000.000Z", "cur/eks-cost/20220901-20221001/a/eks-cost-1.csv"),
+		"cur/eks-cost/20220901-20221001/a/eks-cost-1.csv":         curCSVSample,
+		"cur/eks-cost/20221001-20221101/eks-cost-Manifest.json":   manifest("20221001T000000.000Z", "20221101T000000.000Z", "cur/eks-cost/20221001-20221101/b/eks-cost-1.csv"),
+		"cur/eks-cost/20221001-20221101/a/eks-cost-Manifest.json": manifest("20221001T000000.000Z", "20221101T000000.000Z", "cur/eks-cost/20221001-20221101/a/eks-cost-1.csv"),
+		"cur/eks-cost/20221001-20221101/a/eks-cost-1.csv":         curCSVSample,
+		"cur/eks-cost/20221001-20221101/b/eks-cost-1.csv":         curCSVSample,
+	}}
+
+	aggregator := newCURAggregator(time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC))
+	if err := readS3CUR(context.Background(), svc, "billing", "cur/eks-cost/", aggregator); err != nil {
+		t.Fatalf("readS3CUR() error = %v", err)
+	}
+	want := []string{
+		"cur/eks-cost/20220901-20221001/eks-cost-Manifest.json",
+		"cur/eks-cost/20221001-20221101/eks-cost-Manifest.json",
+		"cur/eks-cost/20221001-20221101/b/eks-cost-1.csv",
+	}
+	if !reflect.DeepEqual(svc.read, want) {
+		t.Errorf("readS3CUR() read %v, want %v", svc.read, want)
+	}
+	got := aggregator.result()
+	if len(got) != len(curSampleUsage) {
+		t.Fatalf("readS3CUR() = %v, want %v", got, curSampleUsage)
+	}
+	for i := range got {
+		if !curUsageEqual(got[i], curSampleUsage[i]) {
+			t.Errorf("readS3CUR() = %v, want %v", got[i], curSampleUsage[i])
+		}
+	}
+}
+
+func Test_readLocalCUR(t *testing.T) {
+	manifest := func(start, end, key string) string {
+		return fmt.Sprintf(`{"reportKeys":[%q],"billingPeriod":{"start":%q,"end":%q}}`, key, start, end)
+	}
+	// A local copy of s3://billing/cur/eks-cost/ with two assemblies of the October report.
+	dir := t.TempDir()
+	files := map[string]string{
+		"eks-cost/20220901-20221001/eks-cost-Manifest.json":   manifest("20220901T000000.000Z", "20221001T000000.000Z", "cur/eks-cost/20220901-20221001/a/eks-cost-1.csv"),
+		"eks-cost/20220901-20221001/a/eks-cost-1.csv":         curCSVSample,
+		"eks-cost/20221001-20221101/eks-cost-Manifest.json":   manifest("20221001T000000.000Z", "20221101T000000.000Z", "cur/eks-cost/20221001-20221101/b/eks-cost-1.csv"),
+		"eks-cost/20221001-20221101/a/eks-cost-Manifest.json": manifest("20221001T000000.000Z", "20221101T000000.000Z", "cur/eks-cost/20221001-20221101/a/eks-cost-1.csv"),
+		"eks-cost/20221001-20221101/a/eks-cost-1.csv":         curCSVSample,
+		"eks-cost/20221001-20221101/b/eks-cost-1.csv":         curCSVSample,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aggregator := newCURAggregator(time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC))
+	if err := readLocalCUR(context.Background(), dir, aggregator); err != nil {
+		t.Fatalf("readLocalCUR() error = %v", err)
+	}
+	got := aggregator.result()
+	if len(got) != len(curSampleUsage) {
+		t.Fatalf("readLocalCUR() = %v, want %v", got, curSampleUsage)
+	}
+	for i := range got {
+		if !curUsageEqual(got[i], curSampleUsage[i]) {
+			t.Errorf("readLocalCUR() = %v, want the latest assembly only %v", got[i], curSampleUsage[i])
+		}
+	}
+}
+
+func TestCURMetricPartial(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report-00001.csv"), []byte(curCSVSample), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	broken := curCSVSample + "6,111,Usage,2022-10-10T02:00:00Z,AmazonEC2,EU-BoxUsage:m5.large,eu-west-1a,one,0.1,m5.large,,\n"
+	if err := os.WriteFile(filepath.Join(dir, "report-00002.csv"), []byte(broken), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.CURSource = dir
+	got, err := CURMetric(context.Background(), cfg, time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC))
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Skipped != 1 {
+		t.Fatalf("CURMetric() error = %v, want a partial error skipping report-00002.csv", err)
+	}
+	if len(got) != len(curSampleUsage) {
+		t.Fatalf("CURMetric() = %v, want %v", got, curSampleUsage)
+	}
+	for i := range got {
+		if !curUsageEqual(got[i], curSampleUsage[i]) {
+			t.Errorf("CURMetric() = %v, want %v", got[i], curSampleUsage[i])
+		}
+	}
+}
+
+type curParquetRow struct {
+	UsageAccountID string    `parquet:"line_item_usage_account_id"`
+	LineItemType   string    `parquet:"line_item_line_item_type"`
+	UsageStartDate time.Time `parquet:"line_item_usage_start_date,timestamp(millisecond)"`
+	ProductCode    string    `parquet:"line_item_product_code"`
+	UsageType      string    `parquet:"line_item_usage_type"`
+	AZ             string    `parquet:"line_item_availability_zone"`
+	UsageAmount    float64   `parquet:"line_item_usage_amount"`
+	UnblendedCost  float64   `parquet:"line_item_unblended_cost"`
+	InstanceType   string    `parquet:"product_instance_type"`
+}
+
+func Test_parseCURParquet(t *testing.T) {
+	start := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	err := parquet.Write(&b, []curParquetRow{
+		{"111", "Usage", start, "AmazonEC2", "EU-SpotUsage:m5.large", "eu-west-1b", 2, 0.08, "m5.large"},
+		{"111", "Usage", start, "AmazonEC2", "EU-DataTransfer-Out-Bytes", "", 1, 0.01, ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator := newCURAggregator(start)
+	if err := parseCURFile("report.snappy.parquet", &b, aggregator.add); err != nil {
+		t.Fatalf("parseCURFile() error = %v", err)
+	}
+	got := aggregator.result()
+	if len(got) != 1 || !curUsageEqual(got[0], curSampleUsage[1]) {
+		t.Errorf("parseCURFile() = %v, want %v", got, curSampleUsage[1:])
+	}
+}
+
+func curUsageEqual(got, want CURUsage) bool {
+	return floatEqual(got.Hours, want.Hours) && floatEqual(got.Cost, want.Cost) &&
+		reflect.DeepEqual(CURUsage{AccountID: got.AccountID, InstanceType: got.InstanceType, CapacityType: got.CapacityType, AZ: got.AZ, Date: got.Date},
+			CURUsage{AccountID: want.AccountID, InstanceType: want.InstanceType, CapacityType: want.CapacityType, AZ: want.AZ, Date: want.Date})
+}
+
+func floatEqual(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func Test_curCalc(t *testing.T) {
+	snapshot := &Snapshot{
+		AccountID: "111",
+		OnDemand:  []*Price{{InstanceType: "m5.large", Price: 0.25}},
+		Spot:      []Spot{{InstanceType: "m5.large", AZ: "eu-west-1b", AccountID: "111", Price: 0.125}},
+		CURUsage: []CURUsage{
+			{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacityOnDemand, AZ: "eu-west-1a", Date: "2022-10-10", Hours: 2, Cost: 0.25},
+			{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacitySpot, AZ: "eu-west-1b", Date: "2022-10-10", Hours: 2, Cost: 0.5},
+			{AccountID: "222", InstanceType: "m5.large", CapacityType: CapacitySpot, AZ: "eu-west-1c", Date: "2022-10-10", Hours: 2, Cost: 0.5},
+			{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacitySpot, AZ: "eu-west-1b", Date: "2022-10-11", Hours: 2, Cost: 0.25},
+			{AccountID: "111", InstanceType: "m5.large", CapacityType: CapacitySpot, AZ: "eu-west-1c", Date: "2022-10-11", Hours: 2, Cost: 0.25},
+		},
+	}
+	labels := []string{AccountID, "instance_type", "capacity_type", Date}
+	actual := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "actual", Help: "Actual"}, labels)
+	estimated := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "estimated", Help: "Estimated"}, labels)
+	ratio := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ratio", Help: "Ratio"}, labels)
+	curCalc(snapshot, actual, estimated, ratio)
+
+	want := `
+# HELP ratio Ratio
+# TYPE ratio gauge
+ratio{account_id="111",capacity_type="ON_DEMAND",date="2022-10-10",instance_type="m5.large"} 0.5
+ratio{account_id="111",capacity_type="SPOT",date="2022-10-10",instance_type="m5.large"} 2
+`
+	if err := testutil.CollectAndCompare(ratio, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	// The spot usage in an AZ without price has an actual cost but no estimate, even with the usage of other AZs priced.
+	if got := testutil.CollectAndCount(actual); got != 4 {
+		t.Errorf("curCalc() actual costs = %d, want 4", got)
+	}
+	if got := testutil.CollectAndCount(estimated); got != 2 {
+		t.Errorf("curCalc() estimated costs = %d, want 2", got)
+	}
+}
@@ -0,0 +1,226 @@
+package cloud
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// Currency label.
+	Currency = "currency"
+	// CurrencyUSD is the currency of the AWS prices.
+	CurrencyUSD = "USD"
+	// CurrencyEUR is the base currency of the ECB reference rates.
+	CurrencyEUR = "EUR"
+
+	convertedSuffix = "_converted"
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// moneyMetrics are the metric families holding USD amounts, exported converted to the configured currencies.
+var moneyMetrics = map[string]bool{
+	"instance_cost_all":                 true,
+	"instance_cost":                     true,
+	"instance_cpu_price":                true,
+	"instance_mem_price":                true,
+	"instance_spot_price":               true,
+	"ec2_instance_cost_hourly":          true,
+	"cur_instance_cost_daily":           true,
+	"cur_instance_estimated_cost_daily": true,
+	"cost_explorer_cost_daily":          true,
+	"cost_explorer_tag_cost_daily":      true,
+	"node_cost_hourly":                  true,
+	"pod_cost_hourly":                   true,
+	"namespace_cost_hourly":             true,
+}
+
+// RateSource provides exchange rates as units of currency per USD.
+type RateSource interface {
+	Rates(ctx context.Context) (map[string]float64, error)
+}
+
+// StaticRates are exchange rates per USD set in the config.
+type StaticRates map[string]float64
+
+// Rates returns the static rates.
+func (r StaticRates) Rates(_ context.Context) (map[string]float64, error) {
+	return r, nil
+}
+
+// ECBRates reads the rates from a feed in the format of the European Central Bank reference rates,
+// e.g. https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml.
+type ECBRates struct {
+	// Source is the URL or path of the feed.
+	Source string
+}
+
+// Rates returns the latest rates of the feed.
+func (r ECBRates) Rates(ctx context.Context) (map[string]float64, error) {
+	body, err := openSource(ctx, r.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return parseECBRates(body)
+}
+
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// parseECBRates parses the rates per EUR of the first day of the feed, the latest one, into rates per USD.
+func parseECBRates(reader io.Reader) (map[string]float64, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(reader).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("parse ECB rates: %w", err)
+	}
+	if len(envelope.Days) == 0 {
+		return nil, fmt.Errorf("parse ECB rates: no rates")
+	}
+
+	perEUR := map[string]float64{CurrencyEUR: 1}
+	for _, rate := range envelope.Days[0].Rates {
+		perEUR[rate.Currency] = rate.Rate
+	}
+	usd := perEUR[CurrencyUSD]
+	if usd <= 0 {
+		return nil, fmt.Errorf("parse ECB rates: no %s rate on %s", CurrencyUSD, envelope.Days[0].Time)
+	}
+
+	rates := make(map[string]float64, len(perEUR))
+	for currency, rate := range perEUR {
+		rates[currency] = rate / usd
+	}
+
+	return rates, nil
+}
+
+// rateSource returns the feed of the config when set, its static rates otherwise.
+func (c Config) rateSource() RateSource {
+	if c.CurrencyRateSource != "" {
+		return ECBRates{Source: c.CurrencyRateSource}
+	}
+
+	return StaticRates(c.CurrencyRates)
+}
+
+// CurrencyRates returns the rates per USD of the currencies of the config from its rate source.
+// The currencies without rate are skipped with a partial error.
+func CurrencyRates(ctx context.Context, cfg Config) (map[string]float64, error) {
+	return currencyRates(ctx, cfg.rateSource(), cfg.Currencies)
+}
+
+func currencyRates(ctx context.Context, source RateSource, currencies []string) (map[string]float64, error) {
+	all, err := source.Rates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("currency rates: %w", err)
+	}
+
+	// A currency without rate is skipped, the other ones are still converted.
+	rates := make(map[string]float64, len(currencies))
+	errs := []error{}
+	for _, currency := range currencies {
+		rate, ok := all[currency]
+		if currency == CurrencyUSD {
+			rate, ok = 1, true
+		}
+		if !ok || rate <= 0 {
+			errs = append(errs, fmt.Errorf("no rate for %s", currency))
+
+			continue
+		}
+		rates[currency] = rate
+	}
+	if len(errs) > 0 && len(rates) == 0 {
+		return nil, joinPartial(collectorCurrencyRates, errs)
+	}
+
+	return rates, joinPartial(collectorCurrencyRates, errs)
+}
+
+// validateCurrencies checks the currencies have a code and a rate when no rate source is set.
+func (c Config) validateCurrencies() error {
+	for _, currency := range c.Currencies {
+		if !currencyCode.MatchString(currency) {
+			return fmt.Errorf("invalid currency %q", currency)
+		}
+		if c.CurrencyRateSource == "" && currency != CurrencyUSD && c.CurrencyRates[currency] <= 0 {
+			return fmt.Errorf("no rate for currency %s", currency)
+		}
+	}
+
+	return nil
+}
+
+type currencyGatherer struct {
+	gatherer prometheus.Gatherer
+	rates    map[string]float64
+}
+
+// CurrencyGatherer adds to the USD amounts of g a <name>_converted family with the amounts in every currency of rates.
+func CurrencyGatherer(g prometheus.Gatherer, rates map[string]float64) prometheus.Gatherer {
+	if len(rates) == 0 {
+		return g
+	}
+
+	return currencyGatherer{gatherer: g, rates: rates}
+}
+
+// Gather implements prometheus.Gatherer.
+func (g currencyGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	currencies := make([]string, 0, len(g.rates))
+	for currency := range g.rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	result := families
+	for _, family := range families {
+		if !moneyMetrics[family.GetName()] || family.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		result = append(result, g.convert(family, currencies))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+
+	return result, err
+}
+
+// convert returns the converted family of a gauge family.
+func (g currencyGatherer) convert(family *dto.MetricFamily, currencies []string) *dto.MetricFamily {
+	name := family.GetName() + convertedSuffix
+	help := strings.TrimSuffix(family.GetHelp(), ".") + " converted to the currency"
+	converted := &dto.MetricFamily{Name: &name, Help: &help, Type: family.Type}
+	for _, currency := range currencies {
+		currency := currency
+		for _, metric := range family.Metric {
+			value := metric.GetGauge().GetValue() * g.rates[currency]
+			labels := append([]*dto.LabelPair{{Name: stringPtr(Currency), Value: &currency}}, metric.Label...)
+			sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+			converted.Metric = append(converted.Metric, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: &value}})
+		}
+	}
+
+	return converted
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,97 @@
+package cloud
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const ecbSample = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2022-10-10">
+			<Cube currency="USD" rate="0.8"/>
+			<Cube currency="GBP" rate="0.6"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func Test_parseECBRates(t *testing.T) {
+	got, err := parseECBRates(strings.NewReader(ecbSample))
+	if err != nil {
+		t.Fatalf("parseECBRates() error = %v", err)
+	}
+	want := map[string]float64{"EUR": 1.25, "USD": 1, "GBP": 0.75}
+	for currency, rate := range want {
+		if !floatEqual(got[currency], rate) {
+			t.Errorf("parseECBRates()[%s] = %v, want %v", currency, got[currency], rate)
+		}
+	}
+
+	if _, err := parseECBRates(strings.NewReader(`<Envelope><Cube><Cube time="2022-10-10"><Cube currency="GBP" rate="0.6"/></Cube></Cube></Envelope>`)); err == nil {
+		t.Error("parseECBRates() without USD rate, want error")
+	}
+}
+
+func Test_currencyRates(t *testing.T) {
+	tests := []struct {
+		name       string
+		currencies []string
+		want       map[string]float64
+		wantErr    bool
+	}{
+		{name: "Test static rates", currencies: []string{"EUR"}, want: map[string]float64{"EUR": 0.5}},
+		{name: "Test USD", currencies: []string{"USD"}, want: map[string]float64{"USD": 1}},
+		{name: "Test missing rate", currencies: []string{"GBP"}, wantErr: true},
+		{name: "Test partial rates", currencies: []string{"EUR", "GBP"}, want: map[string]float64{"EUR": 0.5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := currencyRates(context.Background(), StaticRates{"EUR": 0.5}, tt.currencies)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("currencyRates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("currencyRates() = %v, want %v", got, tt.want)
+			}
+			for currency, rate := range tt.want {
+				if got[currency] != rate {
+					t.Errorf("currencyRates()[%s] = %v, want %v", currency, got[currency], rate)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrencyGatherer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cost := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "node_cost_hourly", Help: "Hourly cost of the node"}, []string{"node"})
+	count := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "instance_count", Help: "Running instances"}, []string{"az"})
+	reg.MustRegister(cost, count)
+	cost.WithLabelValues("a").Set(2)
+	count.WithLabelValues("eu-west-1a").Set(3)
+
+	want := `
+# HELP instance_count Running instances
+# TYPE instance_count gauge
+instance_count{az="eu-west-1a"} 3
+# HELP node_cost_hourly Hourly cost of the node
+# TYPE node_cost_hourly gauge
+node_cost_hourly{node="a"} 2
+# HELP node_cost_hourly_converted Hourly cost of the node converted to the currency
+# TYPE node_cost_hourly_converted gauge
+node_cost_hourly_converted{currency="EUR",node="a"} 1
+node_cost_hourly_converted{currency="GBP",node="a"} 1.5
+`
+	g := CurrencyGatherer(reg, map[string]float64{"EUR": 0.5, "GBP": 0.75})
+	if err := testutil.GatherAndCompare(g, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if CurrencyGatherer(reg, nil) != prometheus.Gatherer(reg) {
+		t.Error("CurrencyGatherer() without rates, want the gatherer")
+	}
+}
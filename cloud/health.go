@@ -0,0 +1,97 @@
+package cloud
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Collectors of a snapshot, the health is recorded for the ones enabled in the config.
+const (
+	collectorPrices        = "prices"
+	collectorInterruptions = "interruptions"
+	collectorAccounts      = "accounts"
+	collectorCUR           = "cur"
+	collectorCostExplorer  = "costExplorer"
+	collectorCurrencyRates = "currencyRates"
+	// CollectorSnapshotFile is the loading of the snapshot file of the config.
+	CollectorSnapshotFile = "snapshotFile"
+	// CollectorRefresh is the first refresh of the snapshot, retried until it succeeds.
+	CollectorRefresh = "refresh"
+	// CollectorLeader is the fetching of the snapshot of the leader by a follower, or the refresh of a replica elected,
+	// retried until it succeeds.
+	CollectorLeader = "leader"
+)
+
+// CollectorStatus is the outcome of the last runs of a collector.
+type CollectorStatus struct {
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Health records the last success and error of the collectors of every snapshot, safe for concurrent use.
+type Health struct {
+	mu         sync.Mutex
+	collectors map[string]CollectorStatus
+}
+
+// NewHealth returns the health of collectors not run yet.
+func NewHealth() *Health {
+	return &Health{collectors: map[string]CollectorStatus{}}
+}
+
+// Record records the outcome of a run of the collector, a nil health records nothing.
+func (h *Health) Record(collector string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	status := h.collectors[collector]
+	if err != nil {
+		status.LastError, status.LastErrorAt = err.Error(), &now
+	} else {
+		status.LastSuccess = &now
+	}
+	h.collectors[collector] = status
+}
+
+// Collectors returns the status of every collector run.
+func (h *Health) Collectors() map[string]CollectorStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make(map[string]CollectorStatus, len(h.collectors))
+	for name, status := range h.collectors {
+		result[name] = status
+	}
+
+	return result
+}
+
+// observe records the health of a collector run started at start and logs its outcome.
+func observe(ctx context.Context, collector string, start time.Time, count int, err error) {
+	healthFrom(ctx).Record(collector, err)
+	if err != nil {
+		slog.WarnContext(ctx, "Collector failed", "collector", collector, "duration", time.Since(start), "error", err)
+
+		return
+	}
+	slog.InfoContext(ctx, "Collector done", "collector", collector, "count", count, "duration", time.Since(start))
+}
+
+type healthKey struct{}
+
+// WithHealth returns a context recording the health of the collections it is passed to.
+func WithHealth(ctx context.Context, h *Health) context.Context {
+	return context.WithValue(ctx, healthKey{}, h)
+}
+
+// healthFrom returns the health of the context, nil when it records none.
+func healthFrom(ctx context.Context) *Health {
+	h, _ := ctx.Value(healthKey{}).(*Health)
+
+	return h
+}
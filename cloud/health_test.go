@@ -0,0 +1,27 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	health := NewHealth()
+	ctx := WithHealth(context.Background(), health)
+	healthFrom(ctx).Record(collectorPrices, nil)
+	healthFrom(ctx).Record(collectorPrices, errors.New("throttled"))
+	healthFrom(ctx).Record(collectorAccounts, nil)
+	healthFrom(context.Background()).Record(collectorCUR, nil)
+
+	got := health.Collectors()
+	if len(got) != 2 {
+		t.Fatalf("Collectors() = %v, want prices and accounts", got)
+	}
+	if prices := got[collectorPrices]; prices.LastSuccess == nil || prices.LastError != "throttled" || prices.LastErrorAt == nil {
+		t.Errorf("Collectors() prices = %+v, want a success and the error", prices)
+	}
+	if accounts := got[collectorAccounts]; accounts.LastSuccess == nil || accounts.LastError != "" {
+		t.Errorf("Collectors() accounts = %+v, want a success only", accounts)
+	}
+}
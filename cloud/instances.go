@@ -0,0 +1,188 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Lifecycle label.
+	Lifecycle = "lifecycle"
+	// LifecycleOnDemand is the lifecycle of the on-demand instances.
+	LifecycleOnDemand = "on-demand"
+	// LifecycleSpot is the lifecycle of the spot instances.
+	LifecycleSpot = "spot"
+	// LifecycleScheduled is the lifecycle of the scheduled instances.
+	LifecycleScheduled = "scheduled"
+)
+
+// instanceLabels are the labels of the per instance cost, which the instance tags can't be exported as.
+var instanceLabels = map[string]bool{"instance_id": true, "instance_type": true, "az": true, "lifecycle": true, AccountID: true}
+
+// Instance is a running EC2 instance with the tags of the config.
+type Instance struct {
+	ID           string
+	InstanceType string
+	AZ           string
+	AccountID    string
+	Lifecycle    string
+	Tags         map[string]string
+}
+
+// CapacityType returns the capacity type the instance is priced with.
+func (i Instance) CapacityType() string {
+	if i.Lifecycle == LifecycleSpot {
+		return CapacitySpot
+	}
+
+	return CapacityOnDemand
+}
+
+// InstanceCount is the number of running instances of an instance type in an AZ.
+type InstanceCount struct {
+	InstanceType string
+	AZ           string
+	AccountID    string
+	Lifecycle    string
+	Count        int
+}
+
+// CapacityType returns the capacity type the instances are priced with.
+func (i InstanceCount) CapacityType() string {
+	return Instance{Lifecycle: i.Lifecycle}.CapacityType()
+}
+
+// lifecycle returns the lifecycle of the instance, on-demand instances having none.
+func lifecycle(instance *ec2.Instance) string {
+	if instance.InstanceLifecycle == nil {
+		return LifecycleOnDemand
+	}
+
+	return aws.StringValue(instance.InstanceLifecycle)
+}
+
+// instanceTags returns the tags of the instance with one of the keys.
+func instanceTags(instance *ec2.Instance, keys []string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range instance.Tags {
+		for _, key := range keys {
+			if aws.StringValue(tag.Key) == key {
+				tags[key] = aws.StringValue(tag.Value)
+			}
+		}
+	}
+
+	return tags
+}
+
+// runningInstances lists the running instances of every reservation, keeping the tags with one of the keys.
+func runningInstances(ctx context.Context, svc ec2iface.EC2API, tagKeys []string) ([]Instance, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{ec2.InstanceStateNameRunning}),
+			},
+		},
+	}
+
+	result := []Instance{}
+	progress := progressFrom(ctx)
+	err := svc.DescribeInstancesPagesWithContext(ctx, input,
+		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			items := 0
+			for _, reservation := range page.Reservations {
+				items += len(reservation.Instances)
+				for _, instance := range reservation.Instances {
+					az := ""
+					if instance.Placement != nil {
+						az = aws.StringValue(instance.Placement.AvailabilityZone)
+					}
+					result = append(result, Instance{
+						ID:           aws.StringValue(instance.InstanceId),
+						InstanceType: aws.StringValue(instance.InstanceType),
+						AZ:           az,
+						Lifecycle:    lifecycle(instance),
+						Tags:         instanceTags(instance, tagKeys),
+					})
+				}
+			}
+			progress.page(StageInstances, items)
+
+			return !lastPage
+		})
+	if err != nil {
+		return nil, fmt.Errorf("DescribeInstancesPages: %w", err)
+	}
+
+	return result, nil
+}
+
+// countInstances counts the instances per instance type, AZ and lifecycle.
+func countInstances(instances []Instance) []InstanceCount {
+	counts := map[InstanceCount]int{}
+	for _, instance := range instances {
+		key := InstanceCount{InstanceType: instance.InstanceType, AZ: instance.AZ, AccountID: instance.AccountID, Lifecycle: instance.Lifecycle}
+		counts[key]++
+	}
+
+	result := make([]InstanceCount, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AccountID != result[j].AccountID {
+			return result[i].AccountID < result[j].AccountID
+		}
+		if result[i].InstanceType != result[j].InstanceType {
+			return result[i].InstanceType < result[j].InstanceType
+		}
+		if result[i].AZ != result[j].AZ {
+			return result[i].AZ < result[j].AZ
+		}
+
+		return result[i].Lifecycle < result[j].Lifecycle
+	})
+
+	return result
+}
+
+// instanceCostCalc sets the hourly cost of every running instance with a known price.
+func instanceCostCalc(s *Snapshot, tagLabels map[string]string, instanceCost *prometheus.GaugeVec) {
+	for _, instance := range s.Instances {
+		price, ok := s.AccountHourlyPrice(instance.AccountID, instance.InstanceType, instance.CapacityType(), instance.AZ)
+		if !ok {
+			continue
+		}
+		labels := prometheus.Labels{
+			"instance_id":   instance.ID,
+			"instance_type": instance.InstanceType,
+			"az":            instance.AZ,
+			"lifecycle":     instance.Lifecycle,
+			AccountID:       instance.AccountID,
+		}
+		for name, key := range tagLabels {
+			if key != "" {
+				labels[name] = instance.Tags[key]
+			}
+		}
+		instanceCost.With(labels).Set(price)
+	}
+}
+
+// InstanceMetric returns the running instances of the account with the tags of the keys.
+func InstanceMetric(ctx context.Context, tagKeys []string) ([]Instance, error) {
+	ses, err := newSession()
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	return runningInstances(ctx, ec2.New(ses, aws.NewConfig().WithRegion("eu-west-1")), tagKeys)
+}
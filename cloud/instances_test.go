@@ -0,0 +1,111 @@
+package cloud
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeInstancesEC2 struct {
+	ec2iface.EC2API
+	pages []*ec2.DescribeInstancesOutput
+}
+
+func (f *fakeInstancesEC2) DescribeInstancesPagesWithContext(_ aws.Context, _ *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, _ ...request.Option) error {
+	for i, page := range f.pages {
+		if !fn(page, i == len(f.pages)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func newInstance(id, instanceType, az string, lifecycle *string, tags ...*ec2.Tag) *ec2.Instance {
+	return &ec2.Instance{
+		InstanceId:        aws.String(id),
+		InstanceType:      aws.String(instanceType),
+		InstanceLifecycle: lifecycle,
+		Placement:         &ec2.Placement{AvailabilityZone: aws.String(az)},
+		Tags:              tags,
+	}
+}
+
+func Test_runningInstances(t *testing.T) {
+	svc := &fakeInstancesEC2{pages: []*ec2.DescribeInstancesOutput{
+		{Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{
+				newInstance("i-1", "m5.large", "eu-west-1a", nil,
+					&ec2.Tag{Key: aws.String("eks:cluster-name"), Value: aws.String("prod")},
+					&ec2.Tag{Key: aws.String("Name"), Value: aws.String("node")}),
+				newInstance("i-2", "m5.large", "eu-west-1a", nil),
+				newInstance("i-3", "c5.large", "eu-west-1b", aws.String(LifecycleSpot)),
+			}},
+		}},
+		{Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{newInstance("i-4", "m5.large", "eu-west-1a", aws.String(LifecycleSpot))}},
+			{Instances: []*ec2.Instance{newInstance("i-5", "r5.large", "eu-west-1c", aws.String(LifecycleScheduled))}},
+			{Instances: []*ec2.Instance{{InstanceId: aws.String("i-6"), InstanceType: aws.String("t3.small")}}},
+		}},
+	}}
+
+	progress := NewProgress()
+	got, err := runningInstances(WithProgress(context.Background(), progress), svc, []string{"eks:cluster-name"})
+	if err != nil {
+		t.Fatalf("runningInstances() error = %v", err)
+	}
+	if len(got) != 6 {
+		t.Fatalf("runningInstances() = %v, want 6 instances", got)
+	}
+	if want := (StageProgress{Pages: 2, Items: 6}); progress.Stages()[StageInstances] != want {
+		t.Errorf("runningInstances() progress = %+v, want %+v", progress.Stages()[StageInstances], want)
+	}
+	if want := map[string]string{"eks:cluster-name": "prod"}; !reflect.DeepEqual(got[0].Tags, want) {
+		t.Errorf("runningInstances() tags = %v, want %v", got[0].Tags, want)
+	}
+
+	counts := countInstances(got)
+	want := []InstanceCount{
+		{InstanceType: "c5.large", AZ: "eu-west-1b", Lifecycle: LifecycleSpot, Count: 1},
+		{InstanceType: "m5.large", AZ: "eu-west-1a", Lifecycle: LifecycleOnDemand, Count: 2},
+		{InstanceType: "m5.large", AZ: "eu-west-1a", Lifecycle: LifecycleSpot, Count: 1},
+		{InstanceType: "r5.large", AZ: "eu-west-1c", Lifecycle: LifecycleScheduled, Count: 1},
+		{InstanceType: "t3.small", AZ: "", Lifecycle: LifecycleOnDemand, Count: 1},
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("countInstances() = %v, want %v", counts, want)
+	}
+}
+
+func Test_instanceCostCalc(t *testing.T) {
+	snapshot := &Snapshot{
+		OnDemand: []*Price{{InstanceType: "m5.large", Price: 0.1}},
+		Spot:     []Spot{{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Price: 0.04}},
+		Instances: []Instance{
+			{ID: "i-1", InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Lifecycle: LifecycleSpot, Tags: map[string]string{"eks:cluster-name": "prod"}},
+			{ID: "i-2", InstanceType: "m5.large", AZ: "eu-west-1b", AccountID: "111", Lifecycle: LifecycleOnDemand},
+			{ID: "i-3", InstanceType: "x9.large", AZ: "eu-west-1b", AccountID: "111", Lifecycle: LifecycleOnDemand},
+		},
+	}
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ec2_instance_cost_hourly", Help: "Cost"},
+		[]string{AccountID, "instance_id", "instance_type", "az", "lifecycle", "cluster"})
+	instanceCostCalc(snapshot, map[string]string{"cluster": "eks:cluster-name", "team": ""}, vec)
+
+	want := `
+# HELP ec2_instance_cost_hourly Cost
+# TYPE ec2_instance_cost_hourly gauge
+ec2_instance_cost_hourly{account_id="111",az="eu-west-1a",cluster="prod",instance_id="i-1",instance_type="m5.large",lifecycle="spot"} 0.04
+ec2_instance_cost_hourly{account_id="111",az="eu-west-1b",cluster="",instance_id="i-2",instance_type="m5.large",lifecycle="on-demand"} 0.1
+`
+	if err := testutil.CollectAndCompare(vec, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,150 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+const (
+	// Band label.
+	Band = "band"
+	// spotAdvisorOS is the operating system of the spot advisor data matching the pricing filters.
+	spotAdvisorOS = "Linux"
+)
+
+// SpotInterruption is the spot interruption frequency band of an instance type in a region.
+type SpotInterruption struct {
+	InstanceType string
+	Region       string
+	Band         string
+	// Rate is the upper bound of the interruption frequency band, between 0 and 1.
+	Rate float64
+}
+
+// SpotPlacementScore is the spot placement score of an instance type in an AZ.
+type SpotPlacementScore struct {
+	InstanceType string
+	AZ           string
+	AccountID    string
+	Score        float64
+}
+
+// spotAdvisorData is the spot instance advisor data in the published format.
+type spotAdvisorData struct {
+	Ranges []struct {
+		Index int     `json:"index"`
+		Label string  `json:"label"`
+		Max   float64 `json:"max"`
+	} `json:"ranges"`
+	SpotAdvisor map[string]map[string]map[string]struct {
+		Savings int `json:"s"`
+		Range   int `json:"r"`
+	} `json:"spot_advisor"`
+}
+
+// parseSpotAdvisor returns the interruption frequency bands of the region from the spot advisor data.
+func parseSpotAdvisor(reader io.Reader, region string) ([]SpotInterruption, error) {
+	data := spotAdvisorData{}
+	if err := json.NewDecoder(reader).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decode spot advisor: %w", err)
+	}
+
+	bands := map[int]int{}
+	for i, r := range data.Ranges {
+		bands[r.Index] = i
+	}
+
+	result := []SpotInterruption{}
+	for name, advice := range data.SpotAdvisor[region][spotAdvisorOS] {
+		i, ok := bands[advice.Range]
+		if !ok {
+			return nil, fmt.Errorf("unknown spot advisor range %d for %s", advice.Range, name)
+		}
+		result = append(result, SpotInterruption{
+			InstanceType: name,
+			Region:       region,
+			Band:         data.Ranges[i].Label,
+			Rate:         data.Ranges[i].Max / 100,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].InstanceType < result[j].InstanceType
+	})
+
+	return result, nil
+}
+
+// SpotInterruptionMetric returns the spot interruption frequency bands read from the spot advisor source.
+func SpotInterruptionMetric(ctx context.Context, source string) ([]SpotInterruption, error) {
+	reader, err := openSource(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("spot advisor: %w", err)
+	}
+	defer reader.Close()
+
+	return parseSpotAdvisor(reader, "eu-west-1")
+}
+
+// spotPlacementScores queries the single AZ spot placement score of every instance type.
+func spotPlacementScores(ctx context.Context, svc ec2iface.EC2API, instanceTypes []string, targetCapacity int64) ([]SpotPlacementScore, error) {
+	zones, err := svc.DescribeAvailabilityZonesWithContext(ctx, &ec2.DescribeAvailabilityZonesInput{})
+	if err != nil {
+		return nil, fmt.Errorf("describeAvailabilityZones: %w", err)
+	}
+	zoneNames := map[string]string{}
+	for _, zone := range zones.AvailabilityZones {
+		zoneNames[aws.StringValue(zone.ZoneId)] = aws.StringValue(zone.ZoneName)
+	}
+
+	// An instance type failing is skipped, the scores of the other ones are still returned.
+	result := []SpotPlacementScore{}
+	errs := []error{}
+	for _, name := range instanceTypes {
+		input := &ec2.GetSpotPlacementScoresInput{
+			InstanceTypes:          aws.StringSlice([]string{name}),
+			RegionNames:            aws.StringSlice([]string{"eu-west-1"}),
+			SingleAvailabilityZone: aws.Bool(true),
+			TargetCapacity:         aws.Int64(targetCapacity),
+		}
+		scores := []SpotPlacementScore{}
+		paginator := func(page *ec2.GetSpotPlacementScoresOutput, lastPage bool) bool {
+			for _, score := range page.SpotPlacementScores {
+				scores = append(scores, SpotPlacementScore{
+					InstanceType: name,
+					AZ:           zoneNames[aws.StringValue(score.AvailabilityZoneId)],
+					Score:        float64(aws.Int64Value(score.Score)),
+				})
+			}
+
+			return !lastPage
+		}
+		if err := svc.GetSpotPlacementScoresPagesWithContext(ctx, input, paginator); err != nil {
+			errs = append(errs, fmt.Errorf("getSpotPlacementScores %s: %w", name, err))
+
+			continue
+		}
+		result = append(result, scores...)
+	}
+	if len(errs) > 0 && len(errs) == len(instanceTypes) {
+		return nil, joinPartial("GetSpotPlacementScores", errs)
+	}
+
+	return result, joinPartial("GetSpotPlacementScores", errs)
+}
+
+// SpotPlacementScoreMetric returns the spot placement scores per AZ of the instance types.
+func SpotPlacementScoreMetric(ctx context.Context, instanceTypes []string, targetCapacity int64) ([]SpotPlacementScore, error) {
+	ses, err := newSession()
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	return spotPlacementScores(ctx, ec2.New(ses, aws.NewConfig().WithRegion("eu-west-1")), instanceTypes, targetCapacity)
+}
@@ -0,0 +1,132 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+const spotAdvisorSample = `{
+  "ranges": [
+    {"index": 0, "label": "<5%", "dots": 0, "max": 5},
+    {"index": 1, "label": "5-10%", "dots": 1, "max": 11},
+    {"index": 4, "label": ">20%", "dots": 4, "max": 100}
+  ],
+  "spot_advisor": {
+    "eu-west-1": {
+      "Linux": {
+        "m5.large": {"s": 70, "r": 1},
+        "c5.large": {"s": 60, "r": 0}
+      },
+      "Windows": {
+        "m5.large": {"s": 50, "r": 4}
+      }
+    },
+    "us-east-1": {
+      "Linux": {
+        "m5.large": {"s": 70, "r": 4}
+      }
+    }
+  }
+}`
+
+func Test_parseSpotAdvisor(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []SpotInterruption
+		wantErr bool
+	}{
+		{
+			name: "Test Spot Advisor Linux bands",
+			data: spotAdvisorSample,
+			want: []SpotInterruption{
+				{InstanceType: "c5.large", Region: "eu-west-1", Band: "<5%", Rate: 0.05},
+				{InstanceType: "m5.large", Region: "eu-west-1", Band: "5-10%", Rate: 0.11},
+			},
+		},
+		{
+			name:    "Test Spot Advisor unknown range",
+			data:    `{"ranges": [], "spot_advisor": {"eu-west-1": {"Linux": {"m5.large": {"s": 70, "r": 1}}}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "Test Spot Advisor invalid json",
+			data:    `{`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSpotAdvisor(strings.NewReader(tt.data), "eu-west-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSpotAdvisor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSpotAdvisor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakePlacementEC2 struct {
+	ec2iface.EC2API
+	scores  map[string][]*ec2.SpotPlacementScore
+	failing string
+}
+
+func (f *fakePlacementEC2) DescribeAvailabilityZonesWithContext(aws.Context, *ec2.DescribeAvailabilityZonesInput, ...request.Option) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	return &ec2.DescribeAvailabilityZonesOutput{
+		AvailabilityZones: []*ec2.AvailabilityZone{
+			{ZoneId: aws.String("euw1-az1"), ZoneName: aws.String("eu-west-1b")},
+			{ZoneId: aws.String("euw1-az2"), ZoneName: aws.String("eu-west-1a")},
+		},
+	}, nil
+}
+
+func (f *fakePlacementEC2) GetSpotPlacementScoresPagesWithContext(_ aws.Context, input *ec2.GetSpotPlacementScoresInput, fn func(*ec2.GetSpotPlacementScoresOutput, bool) bool, _ ...request.Option) error {
+	if *input.InstanceTypes[0] == f.failing {
+		return errors.New("unsupported instance type")
+	}
+	fn(&ec2.GetSpotPlacementScoresOutput{SpotPlacementScores: f.scores[*input.InstanceTypes[0]]}, true)
+
+	return nil
+}
+
+func Test_spotPlacementScores(t *testing.T) {
+	svc := &fakePlacementEC2{scores: map[string][]*ec2.SpotPlacementScore{
+		"m5.large": {
+			{AvailabilityZoneId: aws.String("euw1-az1"), Score: aws.Int64(9)},
+			{AvailabilityZoneId: aws.String("euw1-az2"), Score: aws.Int64(3)},
+		},
+	}}
+	want := []SpotPlacementScore{
+		{InstanceType: "m5.large", AZ: "eu-west-1b", Score: 9},
+		{InstanceType: "m5.large", AZ: "eu-west-1a", Score: 3},
+	}
+	got, err := spotPlacementScores(context.Background(), svc, []string{"m5.large", "c5.large"}, 1)
+	if err != nil {
+		t.Fatalf("spotPlacementScores() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spotPlacementScores() = %v, want %v", got, want)
+	}
+
+	svc.failing = "c5.large"
+	got, err = spotPlacementScores(context.Background(), svc, []string{"m5.large", "c5.large"}, 1)
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Skipped != 1 {
+		t.Errorf("spotPlacementScores() error = %v, want a partial error skipping c5.large", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spotPlacementScores() = %v, want %v", got, want)
+	}
+}
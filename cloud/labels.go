@@ -0,0 +1,119 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelSchema is the set of node label keys a provisioning system sets for the instance type, capacity type and zone.
+type LabelSchema struct {
+	InstanceType string `json:"instanceType"`
+	CapacityType string `json:"capacityType"`
+	Zone         string `json:"zone"`
+	// CapacityTypeValues maps the SPOT and ON_DEMAND capacity types to the label values, e.g. spot and on-demand
+	// for Karpenter. The capacity types missing from the map are used as is.
+	CapacityTypeValues map[string]string `json:"capacityTypeValues"`
+}
+
+// DefaultLabelSchema returns the EKS managed node group label schema.
+func DefaultLabelSchema() LabelSchema {
+	return LabelSchema{
+		InstanceType: "beta.kubernetes.io/instance-type",
+		CapacityType: "eks.amazonaws.com/capacityType",
+		Zone:         "topology.kubernetes.io/zone",
+	}
+}
+
+// Validate checks every label key of the schema is set.
+func (l LabelSchema) Validate() error {
+	if l.InstanceType == "" || l.CapacityType == "" || l.Zone == "" {
+		return fmt.Errorf("label schema %+v: instanceType, capacityType and zone are required", l)
+	}
+	for capacityType := range l.CapacityTypeValues {
+		if capacityType != CapacitySpot && capacityType != CapacityOnDemand {
+			return fmt.Errorf("label schema %s: unknown capacity type %q", l.CapacityType, capacityType)
+		}
+	}
+
+	return nil
+}
+
+// CapacityTypeValue returns the label value of the capacity type.
+func (l LabelSchema) CapacityTypeValue(capacityType string) string {
+	if value, ok := l.CapacityTypeValues[capacityType]; ok {
+		return value
+	}
+
+	return capacityType
+}
+
+// PromLabelName returns the metric label name of a node label key, named like kube-state-metrics does,
+// e.g. eks.amazonaws.com/capacityType is label_eks_amazonaws_com_capacity_type.
+func PromLabelName(key string) string {
+	var b strings.Builder
+	b.WriteString("label_")
+	var prev rune
+	for _, r := range key {
+		switch {
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			b.WriteRune('_')
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune('_')
+		}
+		prev = r
+	}
+
+	return b.String()
+}
+
+// labeler sets the instance type, capacity type and zone labels of a series once per label schema,
+// so the metrics join with the nodes of every provisioning system in the cluster.
+// The account label is always part of the label names, empty for the data shared by all the accounts.
+type labeler struct {
+	schemas []LabelSchema
+	names   []string
+}
+
+func newLabeler(schemas []LabelSchema) labeler {
+	names := []string{AccountID}
+	seen := map[string]bool{AccountID: true}
+	for _, schema := range schemas {
+		for _, key := range []string{schema.InstanceType, schema.CapacityType, schema.Zone} {
+			name := PromLabelName(key)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return labeler{schemas: schemas, names: names}
+}
+
+// labelNames returns the schema label names followed by the other label names of the metric.
+func (l labeler) labelNames(others ...string) []string {
+	return append(append([]string{}, l.names...), others...)
+}
+
+// set sets the value of the series of every schema, the labels of the other schemas being empty.
+func (l labeler) set(vec *prometheus.GaugeVec, instanceType, capacityType, zone string, others prometheus.Labels, value float64) {
+	for _, schema := range l.schemas {
+		labels := prometheus.Labels{}
+		for _, name := range l.names {
+			labels[name] = ""
+		}
+		for name, v := range others {
+			labels[name] = v
+		}
+		labels[PromLabelName(schema.InstanceType)] = instanceType
+		labels[PromLabelName(schema.CapacityType)] = schema.CapacityTypeValue(capacityType)
+		labels[PromLabelName(schema.Zone)] = zone
+		vec.With(labels).Set(value)
+	}
+}
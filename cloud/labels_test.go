@@ -0,0 +1,52 @@
+package cloud
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPromLabelName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "beta.kubernetes.io/instance-type", want: "label_beta_kubernetes_io_instance_type"},
+		{key: "eks.amazonaws.com/capacityType", want: "label_eks_amazonaws_com_capacity_type"},
+		{key: "karpenter.sh/capacity-type", want: "label_karpenter_sh_capacity_type"},
+		{key: "topology.kubernetes.io/zone", want: AZ},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := PromLabelName(tt.key); got != tt.want {
+				t.Errorf("PromLabelName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelerSet(t *testing.T) {
+	l := newLabeler([]LabelSchema{DefaultLabelSchema(), {
+		InstanceType: "node.kubernetes.io/instance-type",
+		CapacityType: "karpenter.sh/capacity-type",
+		Zone:         "topology.kubernetes.io/zone",
+		CapacityTypeValues: map[string]string{
+			CapacitySpot:     "spot",
+			CapacityOnDemand: "on-demand",
+		},
+	}})
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "instance_cost", Help: "Cost"}, l.labelNames(Region))
+	l.set(vec, "m5.large", "SPOT", "eu-west-1a", prometheus.Labels{AccountID: "111", Region: "eu-west-1"}, 0.1)
+
+	want := `
+# HELP instance_cost Cost
+# TYPE instance_cost gauge
+instance_cost{account_id="111",label_beta_kubernetes_io_instance_type="",label_eks_amazonaws_com_capacity_type="",label_karpenter_sh_capacity_type="spot",label_node_kubernetes_io_instance_type="m5.large",label_topology_kubernetes_io_zone="eu-west-1a",region="eu-west-1"} 0.1
+instance_cost{account_id="111",label_beta_kubernetes_io_instance_type="m5.large",label_eks_amazonaws_com_capacity_type="SPOT",label_karpenter_sh_capacity_type="",label_node_kubernetes_io_instance_type="",label_topology_kubernetes_io_zone="eu-west-1a",region="eu-west-1"} 0.1
+`
+	if err := testutil.CollectAndCompare(vec, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
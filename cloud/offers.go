@@ -0,0 +1,223 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// offerProduct is a product of the offer file.
+type offerProduct struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// matches returns whether the product attributes match the price list filters.
+func (p offerProduct) matches() bool {
+	for _, filter := range filtering {
+		field := aws.StringValue(filter.Field)
+		// The purchase option is an attribute of the reserved terms, not of the products.
+		if field == "PurchaseOption" {
+			continue
+		}
+		if p.Attributes[field] != aws.StringValue(filter.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// OfferFileMetric returns the on-demand prices of the products of the EC2 regional offer file in source,
+// a URL or path of a file in the offers/v1.0/aws/AmazonEC2/current/<region>/index.json format.
+func OfferFileMetric(ctx context.Context, source string) ([]*Price, error) {
+	body, err := openSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	prices, err := parseOfferFile(body)
+	if err != nil {
+		return nil, fmt.Errorf("offer file %s: %w", source, err)
+	}
+	progressFrom(ctx).items(StageOnDemand, len(prices))
+
+	return prices, nil
+}
+
+// parseOfferFile streams the offer file, keeping only the products matching the filters and their on-demand terms,
+// so the memory used is bounded by the selected products instead of the file size.
+// The products must come before the terms, as in the files published by AWS.
+func parseOfferFile(reader io.Reader) ([]*Price, error) {
+	dec := json.NewDecoder(reader)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var publicationDate string
+	var products []offerProduct
+	terms := map[string]json.RawMessage{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("read key: %w", err)
+		}
+		switch key {
+		case "publicationDate":
+			if err := dec.Decode(&publicationDate); err != nil {
+				return nil, fmt.Errorf("publicationDate: %w", err)
+			}
+		case "products":
+			products, err = parseOfferProducts(dec)
+			if err != nil {
+				return nil, err
+			}
+		case "terms":
+			if products == nil {
+				return nil, fmt.Errorf("terms before products")
+			}
+			if err := parseOfferTerms(dec, products, terms); err != nil {
+				return nil, err
+			}
+		default:
+			if err := skipValue(dec); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	prices := make([]*Price, 0, len(products))
+	for _, product := range products {
+		term, ok := terms[product.SKU]
+		if !ok {
+			continue
+		}
+		price, err := parsingPrice(aws.JSONValue{
+			"publicationDate": publicationDate,
+			"product":         product,
+			"terms":           aws.JSONValue{"OnDemand": term},
+		})
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+
+	return prices, nil
+}
+
+// parseOfferProducts decodes the products object one product at a time, keeping the matching ones.
+func parseOfferProducts(dec *json.Decoder) ([]offerProduct, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, fmt.Errorf("products: %w", err)
+	}
+	products := []offerProduct{}
+	for dec.More() {
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("products: %w", err)
+		}
+		var product offerProduct
+		if err := dec.Decode(&product); err != nil {
+			return nil, fmt.Errorf("products: %w", err)
+		}
+		if product.matches() {
+			products = append(products, product)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("products: %w", err)
+	}
+
+	return products, nil
+}
+
+// parseOfferTerms adds to terms the on-demand terms of the products, skipping the other term types.
+func parseOfferTerms(dec *json.Decoder, products []offerProduct, terms map[string]json.RawMessage) error {
+	skus := make(map[string]bool, len(products))
+	for _, product := range products {
+		skus[product.SKU] = true
+	}
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return fmt.Errorf("terms: %w", err)
+	}
+	for dec.More() {
+		termType, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("terms: %w", err)
+		}
+		if termType != "OnDemand" {
+			if err := skipValue(dec); err != nil {
+				return fmt.Errorf("terms: %w", err)
+			}
+
+			continue
+		}
+		if err := expectDelim(dec, '{'); err != nil {
+			return fmt.Errorf("terms: %w", err)
+		}
+		for dec.More() {
+			sku, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("terms: %w", err)
+			}
+			if name, ok := sku.(string); !ok || !skus[name] {
+				if err := skipValue(dec); err != nil {
+					return fmt.Errorf("terms: %w", err)
+				}
+
+				continue
+			}
+			var term json.RawMessage
+			if err := dec.Decode(&term); err != nil {
+				return fmt.Errorf("terms: %w", err)
+			}
+			terms[sku.(string)] = term
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("terms: %w", err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("terms: %w", err)
+	}
+
+	return nil
+}
+
+// expectDelim reads the next token and checks it is the delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read token: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected token %v, want %v", token, delim)
+	}
+
+	return nil
+}
+
+// skipValue reads the next value token by token without holding it in memory.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("skip value: %w", err)
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
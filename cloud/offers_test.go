@@ -0,0 +1,105 @@
+package cloud
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const offerFileSample = `{
+  "formatVersion": "v1.0",
+  "offerCode": "AmazonEC2",
+  "publicationDate": "2022-10-05T20:47:09Z",
+  "products": {
+    "USED": {
+      "sku": "USED",
+      "productFamily": "Compute Instance",
+      "attributes": {
+        "instanceType": "m5.large", "vcpu": "2", "memory": "8 GiB", "physicalProcessor": "Intel Xeon Platinum 8175",
+        "regionCode": "eu-west-1", "tenancy": "Shared", "preInstalledSw": "NA", "operatingSystem": "Linux",
+        "marketoption": "OnDemand", "capacitystatus": "Used", "licenseModel": "No License required"
+      }
+    },
+    "RESERVATION": {
+      "sku": "RESERVATION",
+      "productFamily": "Compute Instance",
+      "attributes": {
+        "instanceType": "m5.large", "vcpu": "2", "memory": "8 GiB",
+        "regionCode": "eu-west-1", "tenancy": "Shared", "preInstalledSw": "NA", "operatingSystem": "Linux",
+        "marketoption": "OnDemand", "capacitystatus": "UnusedCapacityReservation", "licenseModel": "No License required"
+      }
+    },
+    "VOLUME": {"sku": "VOLUME", "productFamily": "Storage", "attributes": {"regionCode": "eu-west-1"}}
+  },
+  "terms": {
+    "Reserved": {
+      "USED": {"USED.4NA7Y494T4": {"priceDimensions": {"USED.4NA7Y494T4.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.06"}}}}}
+    },
+    "OnDemand": {
+      "USED": {
+        "USED.JRTCKXETXF": {
+          "effectiveDate": "2022-10-01T00:00:00Z",
+          "priceDimensions": {"USED.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.1070000000"}}}
+        }
+      },
+      "RESERVATION": {
+        "RESERVATION.JRTCKXETXF": {
+          "priceDimensions": {"RESERVATION.JRTCKXETXF.6YS6EN2CT7": {"unit": "Hrs", "pricePerUnit": {"USD": "0.0000000000"}}}
+        }
+      }
+    }
+  },
+  "attributesList": {}
+}`
+
+func TestOfferFileMetric(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := os.WriteFile(path, []byte(offerFileSample), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := OfferFileMetric(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OfferFileMetric() error = %v", err)
+	}
+	want := []*Price{{
+		SKU:             "USED",
+		CapacityStatus:  "Used",
+		LicenseModel:    "No License required",
+		InstanceType:    "m5.large",
+		CPU:             "2",
+		Memory:          "8 GiB",
+		Architecture:    "x86_64",
+		Price:           0.107,
+		Unit:            "Hrs",
+		PublicationDate: time.Date(2022, 10, 5, 20, 47, 9, 0, time.UTC),
+		EffectiveDate:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OfferFileMetric() = %+v, want %+v", got[0], want[0])
+	}
+}
+
+func Test_parseOfferFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "Test terms before products", data: `{"terms": {}, "products": {}}`, wantErr: true},
+		{name: "Test not an object", data: `[]`, wantErr: true},
+		{name: "Test truncated", data: offerFileSample[:len(offerFileSample)/2], wantErr: true},
+		{name: "Test no products", data: `{"products": {}, "terms": {"OnDemand": {}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOfferFile(strings.NewReader(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("parseOfferFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
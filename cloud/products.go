@@ -0,0 +1,95 @@
+package cloud
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// capacityStatusUsed is the capacity status of the products billed for running instances,
+	// as opposed to the unused and allocated capacity reservations.
+	capacityStatusUsed = "Used"
+	// licenseModelNone is the license model of the products without bring your own license.
+	licenseModelNone = "No License required"
+	// SKU label.
+	SKU = "sku"
+)
+
+// PriceConflict reports the products of an instance type equally ranked by the selection rules with different prices.
+type PriceConflict struct {
+	InstanceType string
+	// Chosen is the SKU of the product kept.
+	Chosen string
+	// SKUs are the SKUs of all the equally ranked products.
+	SKUs []string
+}
+
+// productRank ranks a product by the selection rules, the lowest being preferred:
+// the used capacity status first, then no license required.
+func productRank(price *Price) int {
+	rank := 0
+	if price.CapacityStatus != "" && price.CapacityStatus != capacityStatusUsed {
+		rank += 2
+	}
+	if price.LicenseModel != "" && price.LicenseModel != licenseModelNone {
+		rank++
+	}
+
+	return rank
+}
+
+// selectProducts keeps one product per instance type, the best ranked with the lowest SKU,
+// and reports the instance types with several best ranked products of different prices.
+func selectProducts(prices []*Price) ([]*Price, []PriceConflict) {
+	candidates := map[string][]*Price{}
+	for _, price := range prices {
+		candidates[price.InstanceType] = append(candidates[price.InstanceType], price)
+	}
+
+	result := make([]*Price, 0, len(candidates))
+	conflicts := []PriceConflict{}
+	for instanceType, products := range candidates {
+		sort.Slice(products, func(i, j int) bool {
+			if ri, rj := productRank(products[i]), productRank(products[j]); ri != rj {
+				return ri < rj
+			}
+
+			return products[i].SKU < products[j].SKU
+		})
+		chosen := products[0]
+		result = append(result, chosen)
+
+		skus := []string{chosen.SKU}
+		conflict := false
+		for _, product := range products[1:] {
+			if productRank(product) != productRank(chosen) {
+				break
+			}
+			skus = append(skus, product.SKU)
+			conflict = conflict || product.Price != chosen.Price
+		}
+		if conflict {
+			conflicts = append(conflicts, PriceConflict{InstanceType: instanceType, Chosen: chosen.SKU, SKUs: skus})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].InstanceType < result[j].InstanceType })
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].InstanceType < conflicts[j].InstanceType })
+
+	return result, conflicts
+}
+
+// productCalc sets the SKU of the product priced for every instance type, and the number of conflicting products.
+func productCalc(l labeler, s *Snapshot, info, conflicts *prometheus.GaugeVec) {
+	for _, price := range s.OnDemand {
+		l.set(info, price.InstanceType, CapacityOnDemand, "", prometheus.Labels{
+			SKU:    price.SKU,
+			Region: "eu-west-1",
+		}, 1)
+	}
+	for _, conflict := range s.PriceConflicts {
+		l.set(conflicts, conflict.InstanceType, CapacityOnDemand, "", prometheus.Labels{
+			Region: "eu-west-1",
+		}, float64(len(conflict.SKUs)))
+	}
+}
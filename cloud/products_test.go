@@ -0,0 +1,51 @@
+package cloud
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_selectProducts(t *testing.T) {
+	used := &Price{SKU: "B", InstanceType: "m5.large", CapacityStatus: "Used", LicenseModel: "No License required", Price: 0.1}
+	reserved := &Price{SKU: "A", InstanceType: "m5.large", CapacityStatus: "UnusedCapacityReservation", LicenseModel: "No License required", Price: 0.1}
+	byol := &Price{SKU: "C", InstanceType: "m5.large", CapacityStatus: "Used", LicenseModel: "Bring your own license", Price: 0.05}
+	other := &Price{SKU: "D", InstanceType: "m5.large", CapacityStatus: "Used", LicenseModel: "No License required", Price: 0.2}
+	same := &Price{SKU: "E", InstanceType: "m5.large", CapacityStatus: "Used", LicenseModel: "No License required", Price: 0.1}
+	small := &Price{SKU: "F", InstanceType: "t3.small", Price: 0.02}
+	tests := []struct {
+		name          string
+		prices        []*Price
+		want          []*Price
+		wantConflicts []PriceConflict
+	}{
+		{
+			name:          "Test used capacity without license",
+			prices:        []*Price{small, reserved, byol, used},
+			want:          []*Price{used, small},
+			wantConflicts: []PriceConflict{},
+		},
+		{
+			name:          "Test conflicting prices",
+			prices:        []*Price{other, used, reserved},
+			want:          []*Price{used},
+			wantConflicts: []PriceConflict{{InstanceType: "m5.large", Chosen: "B", SKUs: []string{"B", "D"}}},
+		},
+		{
+			name:          "Test duplicated prices",
+			prices:        []*Price{same, used},
+			want:          []*Price{used},
+			wantConflicts: []PriceConflict{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := selectProducts(tt.prices)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectProducts() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("selectProducts() conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package cloud
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+const (
+	// StageOnDemand is the collection of the on-demand prices.
+	StageOnDemand = "onDemand"
+	// StageSpot is the collection of the spot prices of every account.
+	StageSpot = "spot"
+	// StageInstances is the collection of the running instances of every account.
+	StageInstances = "instances"
+)
+
+// StageProgress is the progress of a stage of a snapshot collection.
+type StageProgress struct {
+	// Pages are the API pages read, none for the sources read at once like the offer file.
+	Pages int64 `json:"pages"`
+	Items int64 `json:"items"`
+	Done  bool  `json:"done"`
+}
+
+type stageCounter struct {
+	pages atomic.Int64
+	items atomic.Int64
+	done  atomic.Bool
+}
+
+// Progress counts the pages and items collected per stage by a snapshot collection in flight.
+// It is safe for concurrent use, the accounts being collected in parallel.
+type Progress struct {
+	stages map[string]*stageCounter
+}
+
+// NewProgress returns the progress of a collection not started yet.
+func NewProgress() *Progress {
+	return &Progress{stages: map[string]*stageCounter{
+		StageOnDemand:  {},
+		StageSpot:      {},
+		StageInstances: {},
+	}}
+}
+
+// Stages returns the progress of every stage.
+func (p *Progress) Stages() map[string]StageProgress {
+	result := make(map[string]StageProgress, len(p.stages))
+	for name, stage := range p.stages {
+		result[name] = StageProgress{Pages: stage.pages.Load(), Items: stage.items.Load(), Done: stage.done.Load()}
+	}
+
+	return result
+}
+
+// page counts a page of items of the stage, a nil progress counts nothing.
+func (p *Progress) page(stage string, items int) {
+	if p == nil {
+		return
+	}
+	p.stages[stage].pages.Add(1)
+	p.stages[stage].items.Add(int64(items))
+}
+
+// items counts items of the stage read without paging.
+func (p *Progress) items(stage string, items int) {
+	if p == nil {
+		return
+	}
+	p.stages[stage].items.Add(int64(items))
+}
+
+// done marks the stage as complete.
+func (p *Progress) done(stage string) {
+	if p == nil {
+		return
+	}
+	p.stages[stage].done.Store(true)
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context reporting the progress of the collections it is passed to.
+func WithProgress(ctx context.Context, p *Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the progress of the context, nil when it reports none.
+func progressFrom(ctx context.Context) *Progress {
+	p, _ := ctx.Value(progressKey{}).(*Progress)
+
+	return p
+}
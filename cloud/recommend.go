@@ -0,0 +1,239 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// FormatJSON outputs the recommendations as JSON.
+	FormatJSON = "json"
+	// FormatKarpenter outputs the recommendations as Karpenter NodePool requirements.
+	FormatKarpenter = "karpenter"
+	// FormatASG outputs the recommendations as an ASG mixed instances policy.
+	FormatASG = "asg"
+	// unknownInterruptionRate is the risk assumed for instance types without spot advisor data.
+	unknownInterruptionRate = 1.0
+)
+
+// Requirements are the workload requirements used to recommend spot instance types.
+type Requirements struct {
+	// CPU is the minimum number of vCPUs.
+	CPU int `json:"vcpu"`
+	// Memory is the minimum memory in GiB.
+	Memory int `json:"memory"`
+	// MaxCPU is the maximum number of vCPUs, unlimited when 0.
+	MaxCPU int `json:"maxVcpu"`
+	// MaxMemory is the maximum memory in GiB, unlimited when 0.
+	MaxMemory int `json:"maxMemory"`
+	// Architecture is the CPU architecture, arm64 or x86_64. Any architecture when empty.
+	Architecture string `json:"architecture"`
+	// AZs are the availability zones where the instances run. Any AZ when empty.
+	AZs []string `json:"azs"`
+	// Count is the number of instance types to recommend.
+	Count int `json:"count"`
+	// MaxPerFamily is the maximum number of instance types of the same family, to diversify the spot pools.
+	MaxPerFamily int `json:"maxPerFamily"`
+}
+
+// DefaultRequirements returns the requirements used when a field is not set.
+func DefaultRequirements() Requirements {
+	return Requirements{Count: 10, MaxPerFamily: 2}
+}
+
+// Recommendation is a spot instance type ranked for some workload requirements.
+type Recommendation struct {
+	InstanceType  string   `json:"instanceType"`
+	Family        string   `json:"family"`
+	CPU           int      `json:"vcpu"`
+	Memory        int      `json:"memory"`
+	Architecture  string   `json:"architecture"`
+	AZs           []string `json:"azs"`
+	OnDemandPrice float64  `json:"onDemandPrice"`
+	SpotPrice     float64  `json:"spotPrice"`
+	// UnitPrice is the spot price per unit(1cpu, 1GB) of the instance type.
+	UnitPrice        float64 `json:"unitPrice"`
+	Discount         float64 `json:"discount"`
+	InterruptionRate float64 `json:"interruptionRate"`
+	// Score is the ranking score between 0 and 1, higher is better.
+	Score float64 `json:"score"`
+}
+
+func instanceFamily(name string) string {
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+func (r Requirements) match(price *Price) bool {
+	cpu, memory := price.GetCPU(), price.GetMemory()
+
+	return cpu >= r.CPU && memory >= r.Memory &&
+		(r.MaxCPU == 0 || cpu <= r.MaxCPU) &&
+		(r.MaxMemory == 0 || memory <= r.MaxMemory) &&
+		(r.Architecture == "" || r.Architecture == price.Architecture)
+}
+
+func (r Requirements) matchAZ(az string) bool {
+	if len(r.AZs) == 0 {
+		return true
+	}
+	for _, v := range r.AZs {
+		if v == az {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Recommend ranks the spot instance types of the snapshot matching the requirements by effective unit price,
+// discount and interruption risk, returning a list diversified across instance families.
+func (s *Snapshot) Recommend(req Requirements) []Recommendation {
+	rates := map[string]float64{}
+	for _, interruption := range s.Interruptions {
+		rates[interruption.InstanceType] = interruption.Rate
+	}
+
+	candidates := []Recommendation{}
+	for _, price := range s.OnDemand {
+		if price.Price <= 0 || !req.match(price) {
+			continue
+		}
+		spotPrices := []float64{}
+		azs := []string{}
+		for _, valueSpot := range s.accountSpot(s.AccountID) {
+			if valueSpot.InstanceType == price.InstanceType && req.matchAZ(valueSpot.AZ) {
+				spotPrices = append(spotPrices, valueSpot.Price)
+				azs = append(azs, valueSpot.AZ)
+			}
+		}
+		if len(spotPrices) == 0 {
+			continue
+		}
+		sort.Strings(azs)
+		spot := Spot{InstanceType: price.InstanceType, Price: avg(spotPrices)}
+		unitPrice := spot.CalcUnitPrice(spot, price)
+		rate, ok := rates[price.InstanceType]
+		if !ok {
+			rate = unknownInterruptionRate
+		}
+		candidates = append(candidates, Recommendation{
+			InstanceType:     price.InstanceType,
+			Family:           instanceFamily(price.InstanceType),
+			CPU:              price.GetCPU(),
+			Memory:           price.GetMemory(),
+			Architecture:     price.Architecture,
+			AZs:              azs,
+			OnDemandPrice:    price.Price,
+			SpotPrice:        spot.Price,
+			UnitPrice:        unitPrice.MemPrice,
+			Discount:         unitPrice.Discount,
+			InterruptionRate: rate,
+		})
+	}
+
+	return diversify(score(candidates), req)
+}
+
+// score sets the score of the candidates weighting the unit price relative to the cheapest one by 0.5,
+// the discount by 0.2 and the interruption risk by 0.3, and sorts them by it.
+func score(candidates []Recommendation) []Recommendation {
+	minUnitPrice := 0.0
+	for _, c := range candidates {
+		if c.UnitPrice > 0 && (minUnitPrice == 0 || c.UnitPrice < minUnitPrice) {
+			minUnitPrice = c.UnitPrice
+		}
+	}
+	for i, c := range candidates {
+		priceScore := 0.0
+		if c.UnitPrice > 0 {
+			priceScore = minUnitPrice / c.UnitPrice
+		}
+		candidates[i].Score = 0.5*priceScore + 0.2*c.Discount + 0.3*(1-c.InterruptionRate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+
+		return candidates[i].InstanceType < candidates[j].InstanceType
+	})
+
+	return candidates
+}
+
+// diversify keeps the best ranked candidates limiting the number of instance types per family.
+func diversify(candidates []Recommendation, req Requirements) []Recommendation {
+	perFamily := map[string]int{}
+	result := []Recommendation{}
+	for _, c := range candidates {
+		if req.Count > 0 && len(result) >= req.Count {
+			break
+		}
+		if req.MaxPerFamily > 0 && perFamily[c.Family] >= req.MaxPerFamily {
+			continue
+		}
+		perFamily[c.Family]++
+		result = append(result, c)
+	}
+
+	return result
+}
+
+// WriteRecommendations writes the recommendations to w in the format: json, karpenter or asg.
+func WriteRecommendations(w io.Writer, recommendations []Recommendation, format string) error {
+	names := make([]string, len(recommendations))
+	for i, r := range recommendations {
+		names[i] = r.InstanceType
+	}
+
+	switch format {
+	case FormatJSON, "":
+		return writeJSON(w, recommendations)
+	case FormatKarpenter:
+		var b strings.Builder
+		b.WriteString("requirements:\n")
+		b.WriteString("  - key: karpenter.sh/capacity-type\n    operator: In\n    values: [\"spot\"]\n")
+		b.WriteString("  - key: node.kubernetes.io/instance-type\n    operator: In\n    values:\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "      - %q\n", name)
+		}
+		_, err := io.WriteString(w, b.String())
+
+		return err
+	case FormatASG:
+		type override struct {
+			InstanceType string `json:"InstanceType"`
+		}
+		overrides := make([]override, len(names))
+		for i, name := range names {
+			overrides[i] = override{InstanceType: name}
+		}
+
+		return writeJSON(w, map[string]interface{}{
+			"MixedInstancesPolicy": map[string]interface{}{
+				"LaunchTemplate": map[string]interface{}{
+					"Overrides": overrides,
+				},
+				"InstancesDistribution": map[string]interface{}{
+					"OnDemandPercentageAboveBaseCapacity": 0,
+					"SpotAllocationStrategy":              "price-capacity-optimized",
+				},
+			},
+		})
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	return nil
+}
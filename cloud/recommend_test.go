@@ -0,0 +1,105 @@
+package cloud
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func recommendSnapshot() *Snapshot {
+	return &Snapshot{
+		OnDemand: []*Price{
+			{InstanceType: "m5.large", CPU: "2", Memory: "8 GiB", Architecture: "x86_64", Price: 0.1},
+			{InstanceType: "m5.xlarge", CPU: "4", Memory: "16 GiB", Architecture: "x86_64", Price: 0.2},
+			{InstanceType: "m5.2xlarge", CPU: "8", Memory: "32 GiB", Architecture: "x86_64", Price: 0.4},
+			{InstanceType: "m6g.large", CPU: "2", Memory: "8 GiB", Architecture: "arm64", Price: 0.08},
+			{InstanceType: "c5.large", CPU: "2", Memory: "4 GiB", Architecture: "x86_64", Price: 0.09},
+			{InstanceType: "r5.large", CPU: "2", Memory: "16 GiB", Architecture: "x86_64", Price: 0.12},
+		},
+		Spot: []Spot{
+			{InstanceType: "m5.large", AZ: "eu-west-1a", Price: 0.04},
+			{InstanceType: "m5.large", AZ: "eu-west-1b", Price: 0.02},
+			{InstanceType: "m5.xlarge", AZ: "eu-west-1a", Price: 0.06},
+			{InstanceType: "m5.2xlarge", AZ: "eu-west-1a", Price: 0.12},
+			{InstanceType: "m6g.large", AZ: "eu-west-1a", Price: 0.03},
+			{InstanceType: "c5.large", AZ: "eu-west-1a", Price: 0.03},
+			{InstanceType: "r5.large", AZ: "eu-west-1c", Price: 0.03},
+		},
+		Interruptions: []SpotInterruption{
+			{InstanceType: "m5.large", Band: "<5%", Rate: 0.05},
+			{InstanceType: "m5.xlarge", Band: "<5%", Rate: 0.05},
+			{InstanceType: "m5.2xlarge", Band: ">20%", Rate: 1},
+		},
+	}
+}
+
+func instanceTypes(recommendations []Recommendation) []string {
+	names := []string{}
+	for _, r := range recommendations {
+		names = append(names, r.InstanceType)
+	}
+
+	return names
+}
+
+func TestSnapshotRecommend(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Requirements
+		want []string
+	}{
+		{
+			name: "Test Recommend x86_64 in AZ diversified",
+			req:  Requirements{CPU: 2, Memory: 8, Architecture: "x86_64", AZs: []string{"eu-west-1a"}, Count: 10, MaxPerFamily: 2},
+			want: []string{"m5.xlarge", "m5.large"},
+		},
+		{
+			name: "Test Recommend any architecture limited count",
+			req:  Requirements{CPU: 2, Memory: 8, MaxCPU: 2, Count: 2},
+			want: []string{"m5.large", "r5.large"},
+		},
+		{
+			name: "Test Recommend no match",
+			req:  Requirements{CPU: 64},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := instanceTypes(recommendSnapshot().Recommend(tt.req)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Recommend() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRecommendations(t *testing.T) {
+	recommendations := []Recommendation{{InstanceType: "m5.large"}, {InstanceType: "m6i.large"}}
+	tests := []struct {
+		name     string
+		format   string
+		contains []string
+		wantErr  bool
+	}{
+		{name: "Test json", format: FormatJSON, contains: []string{`"instanceType": "m5.large"`}},
+		{name: "Test karpenter", format: FormatKarpenter, contains: []string{"node.kubernetes.io/instance-type", `- "m6i.large"`}},
+		{name: "Test asg", format: FormatASG, contains: []string{"MixedInstancesPolicy", `"InstanceType": "m6i.large"`}},
+		{name: "Test unknown format", format: "csv", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			err := WriteRecommendations(&b, recommendations, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WriteRecommendations() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, c := range tt.contains {
+				if !strings.Contains(b.String(), c) {
+					t.Errorf("WriteRecommendations() = %s, want %s", b.String(), c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// maxRetryDelay caps the exponential backoff of the retries.
+const maxRetryDelay = 30 * time.Second
+
+var (
+	awsRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aws_request_retries_total",
+		Help: "Retries of the AWS API requests",
+	}, []string{"service", "operation"})
+	awsThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aws_request_throttles_total",
+		Help: "AWS API requests failed with a throttling error",
+	}, []string{"service", "operation"})
+)
+
+// ClientMetrics returns the collectors of the retries and throttles of the AWS clients of the process.
+func ClientMetrics() []prometheus.Collector {
+	return []prometheus.Collector{awsRetries, awsThrottles}
+}
+
+// clientPolicy is the retry and rate limit policy shared by all the AWS clients of the process.
+type clientPolicy struct {
+	mu         sync.Mutex
+	maxRetries int
+	limiter    *rate.Limiter
+}
+
+var clients = newClientPolicy(DefaultConfig())
+
+func newClientPolicy(cfg Config) *clientPolicy {
+	return &clientPolicy{
+		maxRetries: cfg.AWSMaxRetries,
+		limiter:    rate.NewLimiter(rate.Limit(cfg.AWSRateLimit), cfg.AWSRateBurst),
+	}
+}
+
+// configure updates the policy with the settings of the config, keeping the tokens of the limiter.
+func (p *clientPolicy) configure(cfg Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxRetries = cfg.AWSMaxRetries
+	p.limiter.SetLimit(rate.Limit(cfg.AWSRateLimit))
+	p.limiter.SetBurst(cfg.AWSRateBurst)
+}
+
+// apply sets the retryer of the policy on the session and rate limits every attempt of its requests.
+func (p *clientPolicy) apply(ses *session.Session) {
+	p.mu.Lock()
+	maxRetries := p.maxRetries
+	p.mu.Unlock()
+
+	ses.Config.Retryer = metricsRetryer{DefaultRetryer: client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MaxRetryDelay:    maxRetryDelay,
+		MaxThrottleDelay: maxRetryDelay,
+	}}
+	ses.Handlers.Send.PushFrontNamed(request.NamedHandler{Name: "cost-report.RateLimit", Fn: func(r *request.Request) {
+		if err := p.limiter.Wait(r.Context()); err != nil {
+			r.Error = awserr.New(request.CanceledErrorCode, "rate limit wait canceled", err)
+		}
+	}})
+	ses.Handlers.Retry.PushFrontNamed(request.NamedHandler{Name: "cost-report.Throttles", Fn: func(r *request.Request) {
+		if r.IsErrorThrottle() {
+			awsThrottles.WithLabelValues(r.ClientInfo.ServiceName, r.Operation.Name).Inc()
+			slog.WarnContext(r.Context(), "AWS request throttled", "service", r.ClientInfo.ServiceName,
+				"operation", r.Operation.Name, "region", aws.StringValue(r.Config.Region), "retry", r.RetryCount)
+		}
+	}})
+}
+
+// metricsRetryer retries with the exponential backoff and jitter of the default retryer, counting the retries.
+type metricsRetryer struct {
+	client.DefaultRetryer
+}
+
+// RetryRules implements request.Retryer, it is only called for the requests retried.
+func (r metricsRetryer) RetryRules(req *request.Request) time.Duration {
+	awsRetries.WithLabelValues(req.ClientInfo.ServiceName, req.Operation.Name).Inc()
+
+	return r.DefaultRetryer.RetryRules(req)
+}
+
+// newSession returns a session applying the client policy.
+func newSession(configs ...*aws.Config) (*session.Session, error) {
+	ses, err := session.NewSession(configs...)
+	if err != nil {
+		return nil, err
+	}
+	clients.apply(ses)
+
+	return ses, nil
+}
+
+// CollectionWarning reports the items a collection skipped while returning the others.
+type CollectionWarning struct {
+	Operation string
+	Skipped   int
+	Message   string
+}
+
+// PartialError is returned with the partial results of a collection that skipped some items.
+type PartialError struct {
+	Operation string
+	Skipped   int
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%s: skipped %d items: %v", e.Operation, e.Skipped, e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// joinPartial returns the partial error of the operation that skipped the items failing with errs, nil without error.
+// The partial errors of errs count their own skipped items.
+func joinPartial(operation string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	skipped := 0
+	for _, err := range errs {
+		var partial *PartialError
+		if errors.As(err, &partial) {
+			skipped += partial.Skipped
+		} else {
+			skipped++
+		}
+	}
+
+	return &PartialError{Operation: operation, Skipped: skipped, Err: errors.Join(errs...)}
+}
+
+// warning returns the warning of the partial error.
+func (e *PartialError) warning() CollectionWarning {
+	return CollectionWarning{Operation: e.Operation, Skipped: e.Skipped, Message: e.Err.Error()}
+}
@@ -0,0 +1,95 @@
+package cloud
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClientPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxRetries    int
+		wantErr       bool
+		wantRetries   float64
+		wantThrottles float64
+	}{
+		{name: "Test retried throttles", maxRetries: 3, wantRetries: 2, wantThrottles: 2},
+		{name: "Test retries exhausted", maxRetries: 1, wantErr: true, wantRetries: 1, wantThrottles: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= 2 {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"__type":"ThrottlingException","message":"Rate exceeded"}`))
+
+					return
+				}
+				w.Write([]byte(`{"PriceList":[]}`))
+			}))
+			defer server.Close()
+
+			cfg := DefaultConfig()
+			cfg.AWSMaxRetries = tt.maxRetries
+			policy := newClientPolicy(cfg)
+			ses := session.Must(session.NewSession(aws.NewConfig().
+				WithRegion("us-east-1").
+				WithEndpoint(server.URL).
+				WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+				WithSleepDelay(func(time.Duration) {})))
+			policy.apply(ses)
+
+			retries := awsRetries.WithLabelValues(pricing.ServiceName, "GetProducts")
+			throttles := awsThrottles.WithLabelValues(pricing.ServiceName, "GetProducts")
+			retriesBefore, throttlesBefore := testutil.ToFloat64(retries), testutil.ToFloat64(throttles)
+			_, err := pricing.New(ses).GetProducts(&pricing.GetProductsInput{ServiceCode: aws.String("AmazonEC2")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetProducts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := testutil.ToFloat64(retries) - retriesBefore; got != tt.wantRetries {
+				t.Errorf("retries = %v, want %v", got, tt.wantRetries)
+			}
+			if got := testutil.ToFloat64(throttles) - throttlesBefore; got != tt.wantThrottles {
+				t.Errorf("throttles = %v, want %v", got, tt.wantThrottles)
+			}
+		})
+	}
+}
+
+func TestSnapshotPartial(t *testing.T) {
+	partial := &PartialError{Operation: "GetProducts", Skipped: 2, Err: errors.New("invalid product")}
+	tests := []struct {
+		name         string
+		hasResults   bool
+		err          error
+		wantErr      bool
+		wantWarnings int
+	}{
+		{name: "Test no error", hasResults: true},
+		{name: "Test partial results", hasResults: true, err: partial, wantWarnings: 1},
+		{name: "Test no results", err: partial, wantErr: true},
+		{name: "Test other error", hasResults: true, err: errors.New("access denied"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Snapshot{}
+			if err := s.partial(tt.hasResults, tt.err); (err != nil) != tt.wantErr {
+				t.Errorf("partial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(s.Warnings) != tt.wantWarnings {
+				t.Errorf("partial() warnings = %v, want %d", s.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// CapacitySpot is the capacity type of spot instances.
+	CapacitySpot = "SPOT"
+	// CapacityOnDemand is the capacity type of on-demand instances.
+	CapacityOnDemand = "ON_DEMAND"
+)
+
+// Snapshot holds all the pricing data collected in a refresh.
+type Snapshot struct {
+	CollectedAt time.Time
+	// AccountID is the first account of the config, the one the node costs and recommendations are computed for,
+	// empty when it is not collected.
+	AccountID string
+	OnDemand  []*Price
+	// PriceConflicts are the instance types with several candidate products for the on-demand price.
+	PriceConflicts  []PriceConflict
+	Spot            []Spot
+	SpotStats       []SpotStat
+	Instances       []Instance
+	Interruptions   []SpotInterruption
+	PlacementScores []SpotPlacementScore
+	CURUsage        []CURUsage
+	DailyCosts      []DailyCost
+	// Warnings report the items skipped by the collections that returned partial results.
+	Warnings []CollectionWarning
+	// CurrencyRates are the exchange rates per USD of the currencies of the config.
+	CurrencyRates map[string]float64
+}
+
+// Counts returns the number of items of every kind of data of the snapshot.
+func (s *Snapshot) Counts() map[string]int {
+	return map[string]int{
+		"onDemand":        len(s.OnDemand),
+		"spot":            len(s.Spot),
+		"spotStats":       len(s.SpotStats),
+		"instances":       len(s.Instances),
+		"interruptions":   len(s.Interruptions),
+		"placementScores": len(s.PlacementScores),
+		"curUsage":        len(s.CURUsage),
+		"dailyCosts":      len(s.DailyCosts),
+	}
+}
+
+// partial records the partial error of a collection with results as a warning, and returns the other errors.
+func (s *Snapshot) partial(hasResults bool, err error) error {
+	var partial *PartialError
+	if hasResults && errors.As(err, &partial) {
+		s.Warnings = append(s.Warnings, partial.warning())
+
+		return nil
+	}
+
+	return err
+}
+
+// optional records the error of a collection the snapshot is exported without as a warning, and returns the error
+// when the context is done.
+func (s *Snapshot) optional(ctx context.Context, operation string, err error) error {
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	s.Warnings = append(s.Warnings, CollectionWarning{Operation: operation, Skipped: 1, Message: err.Error()})
+
+	return nil
+}
+
+// addAccounts adds the data collected from the accounts, the first account of the config being the snapshot account.
+// Without it, the snapshot account is left empty with a warning, so the prices of another account are not taken for it.
+func (s *Snapshot) addAccounts(accounts []accountData) {
+	for _, account := range accounts {
+		if account.First {
+			s.AccountID = account.ID
+		}
+		s.Spot = append(s.Spot, account.Spot...)
+		s.SpotStats = append(s.SpotStats, account.SpotStats...)
+		s.Instances = append(s.Instances, account.Instances...)
+		s.PlacementScores = append(s.PlacementScores, account.PlacementScores...)
+	}
+	if s.AccountID == "" {
+		s.Warnings = append(s.Warnings, CollectionWarning{
+			Operation: collectorAccounts,
+			Message:   "first account not collected, its node costs and the recommendations are skipped",
+		})
+	}
+}
+
+// accountIDs returns the IDs of the accounts with running instances.
+func (s *Snapshot) accountIDs() []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, instance := range s.Instances {
+		if !seen[instance.AccountID] {
+			seen[instance.AccountID] = true
+			ids = append(ids, instance.AccountID)
+		}
+	}
+
+	return ids
+}
+
+// accountSpot returns the spot prices of the account, the AZ names being specific to every account.
+func (s *Snapshot) accountSpot(accountID string) []Spot {
+	result := []Spot{}
+	for _, valueSpot := range s.Spot {
+		if valueSpot.AccountID == accountID {
+			result = append(result, valueSpot)
+		}
+	}
+
+	return result
+}
+
+// OnDemandPrice returns the on-demand price of the instance type.
+func (s *Snapshot) OnDemandPrice(name string) (*Price, bool) {
+	for _, price := range s.OnDemand {
+		if price.InstanceType == name {
+			return price, true
+		}
+	}
+
+	return nil, false
+}
+
+// InUse returns whether instances of the type run in the account with the capacity type, in the AZ for spot instances.
+func (s *Snapshot) InUse(accountID, name, capacityType, az string) bool {
+	for _, instance := range s.Instances {
+		if instance.AccountID == accountID && instance.InstanceType == name && instance.CapacityType() == capacityType &&
+			(capacityType != CapacitySpot || instance.AZ == az) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InstanceAccount returns the account running the instance, the snapshot account when the instance is unknown.
+func (s *Snapshot) InstanceAccount(id string) string {
+	for _, instance := range s.Instances {
+		if instance.ID == id {
+			return instance.AccountID
+		}
+	}
+
+	return s.AccountID
+}
+
+// HourlyPrice returns the hourly price of the instance type for the capacity type in the AZ of the snapshot account.
+func (s *Snapshot) HourlyPrice(name, capacityType, az string) (float64, bool) {
+	return s.AccountHourlyPrice(s.AccountID, name, capacityType, az)
+}
+
+// AccountHourlyPrice returns the hourly price of the instance type for the capacity type in the AZ of the account.
+// There is no price for an unknown account.
+func (s *Snapshot) AccountHourlyPrice(accountID, name, capacityType, az string) (float64, bool) {
+	if accountID == "" {
+		return 0, false
+	}
+	if capacityType != CapacitySpot {
+		price, ok := s.OnDemandPrice(name)
+		if !ok {
+			return 0, false
+		}
+
+		return price.Price, true
+	}
+	for _, valueSpot := range s.accountSpot(accountID) {
+		if valueSpot.InstanceType == name && valueSpot.AZ == az {
+			return valueSpot.Price, true
+		}
+	}
+
+	return 0, false
+}
+
+// UnitPrice returns the price per unit(1cpu, 1GB) of the instance type for the capacity type in the AZ of the snapshot account.
+func (s *Snapshot) UnitPrice(name, capacityType, az string) (OnDemandUnitPrice, bool) {
+	return s.AccountUnitPrice(s.AccountID, name, capacityType, az)
+}
+
+// AccountUnitPrice returns the price per unit(1cpu, 1GB) of the instance type for the capacity type in the AZ of the account.
+// There is no price for an unknown account.
+func (s *Snapshot) AccountUnitPrice(accountID, name, capacityType, az string) (OnDemandUnitPrice, bool) {
+	if accountID == "" {
+		return OnDemandUnitPrice{}, false
+	}
+	price, ok := s.OnDemandPrice(name)
+	if !ok {
+		return OnDemandUnitPrice{}, false
+	}
+	if capacityType != CapacitySpot {
+		return price.CalcUnitPrice(), true
+	}
+	for _, valueSpot := range s.accountSpot(accountID) {
+		if valueSpot.InstanceType == name && valueSpot.AZ == az {
+			return valueSpot.CalcUnitPrice(valueSpot, price).OnDemandUnitPrice, true
+		}
+	}
+
+	return OnDemandUnitPrice{}, false
+}
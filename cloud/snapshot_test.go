@@ -0,0 +1,31 @@
+package cloud
+
+import "testing"
+
+func TestSnapshotInUse(t *testing.T) {
+	snapshot := &Snapshot{Instances: []Instance{
+		{ID: "i-1", InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Lifecycle: LifecycleSpot},
+		{ID: "i-2", InstanceType: "r5.large", AZ: "eu-west-1b", AccountID: "111", Lifecycle: LifecycleScheduled},
+	}}
+	tests := []struct {
+		name         string
+		accountID    string
+		instanceType string
+		capacityType string
+		az           string
+		want         bool
+	}{
+		{name: "Test spot in AZ", accountID: "111", instanceType: "m5.large", capacityType: CapacitySpot, az: "eu-west-1a", want: true},
+		{name: "Test spot in other AZ", accountID: "111", instanceType: "m5.large", capacityType: CapacitySpot, az: "eu-west-1b"},
+		{name: "Test on-demand of spot type", accountID: "111", instanceType: "m5.large", capacityType: CapacityOnDemand},
+		{name: "Test scheduled priced on-demand", accountID: "111", instanceType: "r5.large", capacityType: CapacityOnDemand, want: true},
+		{name: "Test other account", accountID: "222", instanceType: "r5.large", capacityType: CapacityOnDemand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snapshot.InUse(tt.accountID, tt.instanceType, tt.capacityType, tt.az); got != tt.want {
+				t.Errorf("InUse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
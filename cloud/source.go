@@ -0,0 +1,41 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var sourceClient = &http.Client{Timeout: 5 * time.Minute}
+
+// openSource opens source as an HTTP(S) URL or as a local file path.
+func openSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(source) // #nosec G304 -- the source comes from the exporter config
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", source, err)
+		}
+
+		return file, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", source, err)
+	}
+	resp, err := sourceClient.Do(req) // #nosec G107 -- the source comes from the exporter config
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("get %s: unexpected status %s", source, resp.Status)
+	}
+
+	return resp.Body, nil
+}
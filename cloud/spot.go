@@ -0,0 +1,242 @@
+package cloud
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// StatMin is the minimum spot price in the window.
+	StatMin = "min"
+	// StatMax is the maximum spot price in the window.
+	StatMax = "max"
+	// StatAvg is the average spot price in the window.
+	StatAvg = "avg"
+	// StatP50 is the median spot price in the window.
+	StatP50 = "p50"
+	// StatP95 is the 95th percentile of the spot price in the window.
+	StatP95 = "p95"
+	// StatStdDev is the standard deviation of the spot price in the window.
+	StatStdDev = "stddev"
+	// StatLast is the latest spot price in the window.
+	StatLast = "last"
+	// Window label.
+	Window = "window"
+	// Stat label.
+	Stat = "stat"
+)
+
+// SpotStat is a statistic of the spot price history of an instance type in an AZ.
+type SpotStat struct {
+	InstanceType string
+	AZ           string
+	AccountID    string
+	Window       string
+	Stat         string
+	Value        float64
+}
+
+type spotKey struct {
+	InstanceType string
+	AZ           string
+}
+
+// spotRecord is a spot price change event.
+type spotRecord struct {
+	Price     float64
+	Timestamp time.Time
+}
+
+// statFunc computes a statistic of the records in effect between start and end.
+type statFunc func(records []spotRecord, start, end time.Time) float64
+
+var statFuncs = map[string]statFunc{
+	StatMin: func(records []spotRecord, _, _ time.Time) float64 {
+		return sortedPrices(records)[0]
+	},
+	StatMax: func(records []spotRecord, _, _ time.Time) float64 {
+		prices := sortedPrices(records)
+
+		return prices[len(prices)-1]
+	},
+	StatAvg: timeWeightedAvg,
+	StatP50: func(records []spotRecord, _, _ time.Time) float64 {
+		return percentile(sortedPrices(records), 0.5)
+	},
+	StatP95: func(records []spotRecord, _, _ time.Time) float64 {
+		return percentile(sortedPrices(records), 0.95)
+	},
+	StatStdDev: func(records []spotRecord, _, _ time.Time) float64 {
+		return stddev(recordPrices(records))
+	},
+	StatLast: func(records []spotRecord, _, _ time.Time) float64 {
+		return records[len(records)-1].Price
+	},
+}
+
+// groupSpotRecords groups the spot price history by instance type and AZ, sorted by timestamp.
+func groupSpotRecords(spotPrices []*ec2.SpotPrice) map[spotKey][]spotRecord {
+	grouped := map[spotKey][]spotRecord{}
+	for _, value := range spotPrices {
+		price, err := strconv.ParseFloat(*value.SpotPrice, 64)
+		if err != nil {
+			continue
+		}
+		key := spotKey{InstanceType: *value.InstanceType, AZ: *value.AvailabilityZone}
+		record := spotRecord{Price: price}
+		if value.Timestamp != nil {
+			record.Timestamp = *value.Timestamp
+		}
+		grouped[key] = append(grouped[key], record)
+	}
+
+	for _, records := range grouped {
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Timestamp.Before(records[j].Timestamp)
+		})
+	}
+
+	return grouped
+}
+
+// recordsInWindow returns the records in effect since start: the ones with a timestamp equal
+// or after start and the latest one before it, as spot records are price change events.
+// The records must be sorted.
+func recordsInWindow(records []spotRecord, start time.Time) []spotRecord {
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].Timestamp.After(start)
+	})
+	if i > 0 {
+		return records[i-1:]
+	}
+
+	return records
+}
+
+// timeWeightedAvg returns the average of the prices weighted by the time each one was in effect
+// between start and end. Every record holds until the timestamp of the next one. It falls back to
+// the plain average when the records do not span any time.
+func timeWeightedAvg(records []spotRecord, start, end time.Time) float64 {
+	weighted := 0.0
+	total := time.Duration(0)
+	for i, r := range records {
+		from := r.Timestamp
+		if from.Before(start) {
+			from = start
+		}
+		to := end
+		if i+1 < len(records) && records[i+1].Timestamp.Before(end) {
+			to = records[i+1].Timestamp
+		}
+		if to.After(from) {
+			weighted += r.Price * to.Sub(from).Seconds()
+			total += to.Sub(from)
+		}
+	}
+	if total == 0 {
+		return avg(recordPrices(records))
+	}
+
+	return weighted / total.Seconds()
+}
+
+// spotStatistics computes the requested stats of the spot price history for every window ending at end.
+func spotStatistics(spotPrices []*ec2.SpotPrice, windows, stats []string, end time.Time) ([]SpotStat, error) {
+	durations := make([]time.Duration, len(windows))
+	for i, w := range windows {
+		d, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		durations[i] = d
+	}
+
+	grouped := groupSpotRecords(spotPrices)
+	keys := make([]spotKey, 0, len(grouped))
+	for key := range grouped {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].InstanceType != keys[j].InstanceType {
+			return keys[i].InstanceType < keys[j].InstanceType
+		}
+
+		return keys[i].AZ < keys[j].AZ
+	})
+
+	result := []SpotStat{}
+	for _, key := range keys {
+		for i, w := range windows {
+			start := end.Add(-durations[i])
+			records := recordsInWindow(grouped[key], start)
+			if len(records) == 0 {
+				continue
+			}
+			for _, s := range stats {
+				result = append(result, SpotStat{
+					InstanceType: key.InstanceType,
+					AZ:           key.AZ,
+					Window:       w,
+					Stat:         s,
+					Value:        statFuncs[s](records, start, end),
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// maxWindow returns the longest of the windows, or min if all of them are shorter.
+func maxWindow(windows []string, min time.Duration) time.Duration {
+	longest := min
+	for _, w := range windows {
+		if d, err := parseWindow(w); err == nil && d > longest {
+			longest = d
+		}
+	}
+
+	return longest
+}
+
+func recordPrices(records []spotRecord) []float64 {
+	prices := make([]float64, len(records))
+	for i, r := range records {
+		prices[i] = r.Price
+	}
+
+	return prices
+}
+
+func sortedPrices(records []spotRecord) []float64 {
+	prices := recordPrices(records)
+	sort.Float64s(prices)
+
+	return prices
+}
+
+// percentile returns the p percentile of the sorted values using linear interpolation.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+func stddev(array []float64) float64 {
+	mean := avg(array)
+	result := 0.0
+	for _, v := range array {
+		result += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(result / float64(len(array)))
+}
@@ -0,0 +1,162 @@
+package cloud
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func Test_spotStatistics(t *testing.T) {
+	end := time.Date(2022, 10, 10, 12, 0, 0, 0, time.UTC)
+	record := func(price string, ago time.Duration) *ec2.SpotPrice {
+		return &ec2.SpotPrice{
+			AvailabilityZone: aws.String("eu-west-1a"),
+			InstanceType:     aws.String("m5.large"),
+			SpotPrice:        aws.String(price),
+			Timestamp:        aws.Time(end.Add(-ago)),
+		}
+	}
+	type args struct {
+		spotPrices []*ec2.SpotPrice
+		windows    []string
+		stats      []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []SpotStat
+		wantErr bool
+	}{
+		{
+			name: "Test Spot Statistics per window",
+			args: args{
+				spotPrices: []*ec2.SpotPrice{
+					record("0.04", 30*time.Minute),
+					record("0.01", 3*time.Hour),
+					record("0.03", 2*time.Hour),
+					record("0.02", 48*time.Hour),
+				},
+				windows: []string{"1h", "1d"},
+				stats:   []string{StatMin, StatMax, StatLast},
+			},
+			want: []SpotStat{
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1h", Stat: StatMin, Value: 0.03},
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1h", Stat: StatMax, Value: 0.04},
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1h", Stat: StatLast, Value: 0.04},
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1d", Stat: StatMin, Value: 0.01},
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1d", Stat: StatMax, Value: 0.04},
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1d", Stat: StatLast, Value: 0.04},
+			},
+		},
+		{
+			name: "Test Spot Statistics price in effect before the window",
+			args: args{
+				spotPrices: []*ec2.SpotPrice{record("0.02", 48*time.Hour)},
+				windows:    []string{"1h"},
+				stats:      []string{StatAvg},
+			},
+			want: []SpotStat{
+				{InstanceType: "m5.large", AZ: "eu-west-1a", Window: "1h", Stat: StatAvg, Value: 0.02},
+			},
+		},
+		{
+			name: "Test Spot Statistics no history",
+			args: args{
+				spotPrices: []*ec2.SpotPrice{},
+				windows:    []string{"1h"},
+				stats:      []string{StatAvg},
+			},
+			want: []SpotStat{},
+		},
+		{
+			name: "Test Spot Statistics invalid window",
+			args: args{
+				spotPrices: []*ec2.SpotPrice{record("0.02", time.Minute)},
+				windows:    []string{"1y"},
+				stats:      []string{StatAvg},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spotStatistics(tt.args.spotPrices, tt.args.windows, tt.args.stats, end)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("spotStatistics() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spotStatistics() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_statFuncs(t *testing.T) {
+	records := []spotRecord{{Price: 1.0}, {Price: 4.0}, {Price: 2.0}, {Price: 3.0}}
+	tests := []struct {
+		stat string
+		want float64
+	}{
+		{stat: StatMin, want: 1.0},
+		{stat: StatMax, want: 4.0},
+		{stat: StatAvg, want: 2.5},
+		{stat: StatP50, want: 2.5},
+		{stat: StatP95, want: 3.85},
+		{stat: StatStdDev, want: math.Sqrt(1.25)},
+		{stat: StatLast, want: 3.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stat, func(t *testing.T) {
+			if got := statFuncs[tt.stat](records, time.Time{}, time.Time{}); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("%s = %v, want %v", tt.stat, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_timeWeightedAvg(t *testing.T) {
+	start := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	tests := []struct {
+		name    string
+		records []spotRecord
+		want    float64
+	}{
+		{
+			name: "Test price held most of the window",
+			records: []spotRecord{
+				{Price: 1.0, Timestamp: start},
+				{Price: 4.0, Timestamp: start.Add(20 * time.Hour)},
+			},
+			want: 1.5,
+		},
+		{
+			name: "Test price in effect before the window",
+			records: []spotRecord{
+				{Price: 1.0, Timestamp: start.Add(-time.Hour)},
+				{Price: 3.0, Timestamp: start.Add(12 * time.Hour)},
+			},
+			want: 2.0,
+		},
+		{
+			name: "Test records without duration",
+			records: []spotRecord{
+				{Price: 1.0, Timestamp: end},
+				{Price: 2.0, Timestamp: end},
+			},
+			want: 1.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timeWeightedAvg(tt.records, start, end); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("timeWeightedAvg() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Package cluster provides the costs computed from the Kubernetes API.
+package cluster
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClient returns a Kubernetes client for the KUBECONFIG file, or for the in-cluster config when it is not set.
+func NewClient() (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes client: %w", err)
+	}
+
+	return client, nil
+}
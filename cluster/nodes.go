@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"platform-cost-report/cloud"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+var (
+	// instanceTypeLabels are the node labels holding the instance type, in order of preference.
+	instanceTypeLabels = []string{"node.kubernetes.io/instance-type", "beta.kubernetes.io/instance-type"}
+	// capacityTypeLabels are the node labels holding the capacity type, in order of preference.
+	capacityTypeLabels = []string{"karpenter.sh/capacity-type", "eks.amazonaws.com/capacityType"}
+	// zoneLabels are the node labels holding the availability zone, in order of preference.
+	zoneLabels = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+)
+
+// SnapshotFunc returns the current pricing snapshot, nil when there is none yet.
+type SnapshotFunc func() *cloud.Snapshot
+
+// Node is a Kubernetes node with the instance it runs on.
+type Node struct {
+	Name         string
+	AccountID    string
+	InstanceType string
+	CapacityType string
+	Zone         string
+}
+
+func firstLabel(node *corev1.Node, keys []string) string {
+	for _, key := range keys {
+		if value, ok := node.Labels[key]; ok {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// capacityTypeOf maps the capacity type label values to the cloud capacity types with the schema value mappings,
+// otherwise normalizing them, e.g. spot or on-demand. Nodes without capacity type label are considered on-demand.
+func (k labelKeys) capacityTypeOf(value string) string {
+	if value == "" {
+		return cloud.CapacityOnDemand
+	}
+	if capacityType, ok := k.capacityValues[value]; ok {
+		return capacityType
+	}
+
+	return strings.ReplaceAll(strings.ToUpper(value), "-", "_")
+}
+
+// labelKeys are the node labels read for the instance type, capacity type and zone, in order of preference.
+type labelKeys struct {
+	instanceType []string
+	capacityType []string
+	zone         []string
+	// capacityValues maps the capacity type label values back to the cloud capacity types.
+	capacityValues map[string]string
+}
+
+// newLabelKeys returns the label keys of the configured schemas followed by the well-known ones.
+func newLabelKeys(schemas []cloud.LabelSchema) labelKeys {
+	keys := labelKeys{capacityValues: map[string]string{}}
+	for _, schema := range schemas {
+		for capacityType, value := range schema.CapacityTypeValues {
+			keys.capacityValues[value] = capacityType
+		}
+		keys.instanceType = append(keys.instanceType, schema.InstanceType)
+		keys.capacityType = append(keys.capacityType, schema.CapacityType)
+		keys.zone = append(keys.zone, schema.Zone)
+	}
+	keys.instanceType = append(keys.instanceType, instanceTypeLabels...)
+	keys.capacityType = append(keys.capacityType, capacityTypeLabels...)
+	keys.zone = append(keys.zone, zoneLabels...)
+
+	return keys
+}
+
+// nodeInfo maps a Kubernetes node to its instance type, capacity type and zone.
+func nodeInfo(node *corev1.Node, keys labelKeys) Node {
+	return Node{
+		Name:         node.Name,
+		InstanceType: firstLabel(node, keys.instanceType),
+		CapacityType: keys.capacityTypeOf(firstLabel(node, keys.capacityType)),
+		Zone:         firstLabel(node, keys.zone),
+	}
+}
+
+// instanceID returns the EC2 instance ID of the node provider ID, e.g. aws:///eu-west-1a/i-0123456789abcdef0.
+func instanceID(node *corev1.Node) string {
+	if !strings.HasPrefix(node.Spec.ProviderID, "aws://") {
+		return ""
+	}
+
+	return node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:]
+}
+
+// nodeAccount returns the account running the node instance, the snapshot account when the instance is unknown.
+func nodeAccount(node *corev1.Node, snapshot *cloud.Snapshot) string {
+	return snapshot.InstanceAccount(instanceID(node))
+}
+
+// NodeCollector exports the hourly cost of the Kubernetes nodes from the current pricing snapshot.
+type NodeCollector struct {
+	lister   corelisters.NodeLister
+	snapshot SnapshotFunc
+	keys     labelKeys
+	cost     *prometheus.Desc
+}
+
+// NewNodeCollector returns a collector watching the nodes with the informer factory.
+// The nodes are mapped to their instance with the label schemas.
+func NewNodeCollector(factory informers.SharedInformerFactory, snapshot SnapshotFunc, schemas []cloud.LabelSchema) *NodeCollector {
+	return &NodeCollector{
+		lister:   factory.Core().V1().Nodes().Lister(),
+		snapshot: snapshot,
+		keys:     newLabelKeys(schemas),
+		cost: prometheus.NewDesc(
+			"node_cost_hourly",
+			"Hourly cost of the Kubernetes node",
+			[]string{cloud.AccountID, "node", "instance_type", "capacity_type", "zone"}, nil,
+		),
+	}
+}
+
+// Nodes returns the nodes with their hourly cost in their account, skipping the ones without known price.
+func (c *NodeCollector) Nodes() (map[Node]float64, error) {
+	result := map[Node]float64{}
+	snapshot := c.snapshot()
+	if snapshot == nil {
+		return result, nil
+	}
+	nodes, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		info := nodeInfo(node, c.keys)
+		info.AccountID = nodeAccount(node, snapshot)
+		if price, ok := snapshot.AccountHourlyPrice(info.AccountID, info.InstanceType, info.CapacityType, info.Zone); ok {
+			result[info] = price
+		}
+	}
+
+	return result, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *NodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cost
+}
+
+// Collect implements prometheus.Collector.
+func (c *NodeCollector) Collect(ch chan<- prometheus.Metric) {
+	nodes, err := c.Nodes()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.cost, err)
+
+		return
+	}
+	for node, price := range nodes {
+		ch <- prometheus.MustNewConstMetric(c.cost, prometheus.GaugeValue, price,
+			node.AccountID, node.Name, node.InstanceType, node.CapacityType, node.Zone)
+	}
+}
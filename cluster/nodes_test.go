@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"context"
+	"platform-cost-report/cloud"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newNode(name string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func Test_nodeInfo(t *testing.T) {
+	keys := newLabelKeys([]cloud.LabelSchema{{
+		InstanceType: "example.com/instance-type",
+		CapacityType: "example.com/lifecycle",
+		Zone:         "example.com/zone",
+		CapacityTypeValues: map[string]string{
+			cloud.CapacitySpot:     "preemptible",
+			cloud.CapacityOnDemand: "regular",
+		},
+	}})
+	tests := []struct {
+		name string
+		node *corev1.Node
+		want Node
+	}{
+		{
+			name: "Test EKS managed node group",
+			node: newNode("a", map[string]string{
+				"beta.kubernetes.io/instance-type": "m5.large",
+				"eks.amazonaws.com/capacityType":   "SPOT",
+				"topology.kubernetes.io/zone":      "eu-west-1a",
+			}),
+			want: Node{Name: "a", InstanceType: "m5.large", CapacityType: cloud.CapacitySpot, Zone: "eu-west-1a"},
+		},
+		{
+			name: "Test Karpenter node",
+			node: newNode("b", map[string]string{
+				"node.kubernetes.io/instance-type": "c6g.xlarge",
+				"karpenter.sh/capacity-type":       "on-demand",
+				"topology.kubernetes.io/zone":      "eu-west-1b",
+			}),
+			want: Node{Name: "b", InstanceType: "c6g.xlarge", CapacityType: cloud.CapacityOnDemand, Zone: "eu-west-1b"},
+		},
+		{
+			name: "Test configured label schema",
+			node: newNode("d", map[string]string{
+				"example.com/instance-type":   "r5.large",
+				"example.com/lifecycle":       "preemptible",
+				"example.com/zone":            "eu-west-1a",
+				"topology.kubernetes.io/zone": "eu-west-1b",
+			}),
+			want: Node{Name: "d", InstanceType: "r5.large", CapacityType: cloud.CapacitySpot, Zone: "eu-west-1a"},
+		},
+		{
+			name: "Test node without capacity type",
+			node: newNode("c", map[string]string{
+				"node.kubernetes.io/instance-type":       "m5.large",
+				"failure-domain.beta.kubernetes.io/zone": "eu-west-1c",
+			}),
+			want: Node{Name: "c", InstanceType: "m5.large", CapacityType: cloud.CapacityOnDemand, Zone: "eu-west-1c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeInfo(tt.node, keys); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeCollectorNodes(t *testing.T) {
+	otherAccount := newNode("other-account", map[string]string{
+		"node.kubernetes.io/instance-type": "m5.large",
+		"karpenter.sh/capacity-type":       "spot",
+		"topology.kubernetes.io/zone":      "eu-west-1a",
+	})
+	otherAccount.Spec.ProviderID = "aws:///eu-west-1a/i-0222"
+	client := fake.NewSimpleClientset(
+		newNode("spot", map[string]string{
+			"node.kubernetes.io/instance-type": "m5.large",
+			"karpenter.sh/capacity-type":       "spot",
+			"topology.kubernetes.io/zone":      "eu-west-1a",
+		}),
+		newNode("on-demand", map[string]string{
+			"node.kubernetes.io/instance-type": "m5.large",
+			"topology.kubernetes.io/zone":      "eu-west-1b",
+		}),
+		newNode("unknown", map[string]string{
+			"node.kubernetes.io/instance-type": "x9.large",
+		}),
+		otherAccount,
+	)
+	snapshot := &cloud.Snapshot{
+		AccountID: "111",
+		OnDemand:  []*cloud.Price{{InstanceType: "m5.large", Price: 0.1}},
+		Spot: []cloud.Spot{
+			{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "111", Price: 0.04},
+			{InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "222", Price: 0.05},
+		},
+		Instances: []cloud.Instance{{ID: "i-0222", InstanceType: "m5.large", AZ: "eu-west-1a", AccountID: "222", Lifecycle: cloud.LifecycleSpot}},
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	collector := NewNodeCollector(factory, func() *cloud.Snapshot { return snapshot }, cloud.DefaultConfig().LabelSchemas)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+
+	got, err := collector.Nodes()
+	if err != nil {
+		t.Fatalf("Nodes() error = %v", err)
+	}
+	want := map[Node]float64{
+		{Name: "spot", AccountID: "111", InstanceType: "m5.large", CapacityType: cloud.CapacitySpot, Zone: "eu-west-1a"}:          0.04,
+		{Name: "on-demand", AccountID: "111", InstanceType: "m5.large", CapacityType: cloud.CapacityOnDemand, Zone: "eu-west-1b"}: 0.1,
+		{Name: "other-account", AccountID: "222", InstanceType: "m5.large", CapacityType: cloud.CapacitySpot, Zone: "eu-west-1a"}: 0.05,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Nodes() = %v, want %v", got, want)
+	}
+}
+
+func Test_instanceID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		want       string
+	}{
+		{providerID: "aws:///eu-west-1a/i-0123456789abcdef0", want: "i-0123456789abcdef0"},
+		{providerID: "kind://docker/kind/kind-control-plane", want: ""},
+		{providerID: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.providerID, func(t *testing.T) {
+			node := newNode("node", nil)
+			node.Spec.ProviderID = tt.providerID
+			if got := instanceID(node); got != tt.want {
+				t.Errorf("instanceID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
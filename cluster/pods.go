@@ -0,0 +1,295 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"platform-cost-report/cloud"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// IdleNamespace is the namespace the idle node costs are allocated to with the separate overhead policy.
+	IdleNamespace = "__idle__"
+	// SystemNamespace is the namespace the reserved node costs are allocated to with the separate overhead policy.
+	SystemNamespace = "__system__"
+	gib             = 1 << 30
+	usageTimeout    = 10 * time.Second
+)
+
+// Resources are the CPU cores and memory GiB used or requested.
+type Resources struct {
+	CPU    float64
+	Memory float64
+}
+
+func toResources(list corev1.ResourceList) Resources {
+	return Resources{
+		CPU:    list.Cpu().AsApproximateFloat64(),
+		Memory: list.Memory().AsApproximateFloat64() / gib,
+	}
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{CPU: r.CPU + o.CPU, Memory: r.Memory + o.Memory}
+}
+
+func (r Resources) sub(o Resources) Resources {
+	return Resources{CPU: r.CPU - o.CPU, Memory: r.Memory - o.Memory}
+}
+
+func (r Resources) max(o Resources) Resources {
+	if o.CPU > r.CPU {
+		r.CPU = o.CPU
+	}
+	if o.Memory > r.Memory {
+		r.Memory = o.Memory
+	}
+
+	return r
+}
+
+func (r Resources) cost(unit cloud.OnDemandUnitPrice) float64 {
+	return r.CPU*unit.CPUPrice + r.Memory*unit.MemPrice
+}
+
+// UsageFunc returns the resources used by the pods keyed by namespace/name.
+type UsageFunc func(ctx context.Context) (map[string]Resources, error)
+
+// MetricsAPIUsage returns the pod usage from the metrics.k8s.io API served by the metrics-server.
+func MetricsAPIUsage(client kubernetes.Interface) UsageFunc {
+	return func(ctx context.Context) (map[string]Resources, error) {
+		data, err := client.CoreV1().RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1/pods").DoRaw(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("pod metrics: %w", err)
+		}
+		metrics := struct {
+			Items []struct {
+				Metadata struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+				Containers []struct {
+					Usage corev1.ResourceList `json:"usage"`
+				} `json:"containers"`
+			} `json:"items"`
+		}{}
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			return nil, fmt.Errorf("decode pod metrics: %w", err)
+		}
+
+		usage := map[string]Resources{}
+		for _, item := range metrics.Items {
+			key := item.Metadata.Namespace + "/" + item.Metadata.Name
+			for _, container := range item.Containers {
+				usage[key] = usage[key].add(toResources(container.Usage))
+			}
+		}
+
+		return usage, nil
+	}
+}
+
+// PodCost is the hourly cost allocated to a pod. Pod is empty for the overhead of the separate policy.
+type PodCost struct {
+	AccountID string
+	Namespace string
+	Pod       string
+	Node      string
+	Cost      float64
+}
+
+// podRequests returns the effective requests of the pod as the scheduler sees them: the largest of the sum of
+// the containers and of every init container, plus the pod overhead.
+func podRequests(pod *corev1.Pod) Resources {
+	requests := Resources{}
+	for _, container := range pod.Spec.Containers {
+		requests = requests.add(toResources(container.Resources.Requests))
+	}
+	for _, container := range pod.Spec.InitContainers {
+		requests = requests.max(toResources(container.Resources.Requests))
+	}
+
+	return requests.add(toResources(pod.Spec.Overhead))
+}
+
+func isActive(pod *corev1.Pod) bool {
+	return pod.Spec.NodeName != "" && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
+
+// allocate splits the hourly cost of every priced node between its pods using the max of their requests and usage.
+// The reserved capacity of the node is the system overhead and the remaining cost is idle, both allocated with the policy.
+// The pod costs are scaled down to the allocatable cost of the node when they exceed it.
+func allocate(nodes []*corev1.Node, pods []*corev1.Pod, usage map[string]Resources, snapshot *cloud.Snapshot, keys labelKeys, policy string) []PodCost {
+	podsByNode := map[string][]*corev1.Pod{}
+	for _, pod := range pods {
+		if isActive(pod) {
+			podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+		}
+	}
+
+	result := []PodCost{}
+	for _, node := range nodes {
+		info := nodeInfo(node, keys)
+		info.AccountID = nodeAccount(node, snapshot)
+		nodeCost, ok := snapshot.AccountHourlyPrice(info.AccountID, info.InstanceType, info.CapacityType, info.Zone)
+		if !ok {
+			continue
+		}
+		unit, ok := snapshot.AccountUnitPrice(info.AccountID, info.InstanceType, info.CapacityType, info.Zone)
+		if !ok {
+			continue
+		}
+
+		costs := []PodCost{}
+		allocated := 0.0
+		for _, pod := range podsByNode[node.Name] {
+			resources := podRequests(pod).max(usage[pod.Namespace+"/"+pod.Name])
+			cost := resources.cost(unit)
+			allocated += cost
+			costs = append(costs, PodCost{AccountID: info.AccountID, Namespace: pod.Namespace, Pod: pod.Name, Node: node.Name, Cost: cost})
+		}
+		system := toResources(node.Status.Capacity).sub(toResources(node.Status.Allocatable)).cost(unit)
+		if system < 0 {
+			system = 0
+		}
+		if system > nodeCost {
+			system = nodeCost
+		}
+		// Usage above the requests can overcommit the node, the pods then share its allocatable cost.
+		if allocatable := nodeCost - system; allocated > allocatable {
+			for i := range costs {
+				costs[i].Cost *= allocatable / allocated
+			}
+			allocated = allocatable
+		}
+		idle := nodeCost - system - allocated
+
+		result = append(result, distribute(costs, info, system, idle, allocated, policy)...)
+	}
+
+	return result
+}
+
+// distribute allocates the system and idle costs of a node to its pod costs following the policy.
+func distribute(costs []PodCost, node Node, system, idle, allocated float64, policy string) []PodCost {
+	overhead := system + idle
+	switch {
+	case policy == cloud.OverheadProportional && allocated > 0:
+		for i := range costs {
+			costs[i].Cost += overhead * costs[i].Cost / allocated
+		}
+	case policy == cloud.OverheadEven && len(costs) > 0:
+		for i := range costs {
+			costs[i].Cost += overhead / float64(len(costs))
+		}
+	default:
+		// Nodes without pods keep their overhead in the separate namespaces whatever the policy.
+		costs = append(costs,
+			PodCost{AccountID: node.AccountID, Namespace: SystemNamespace, Node: node.Name, Cost: system},
+			PodCost{AccountID: node.AccountID, Namespace: IdleNamespace, Node: node.Name, Cost: idle},
+		)
+	}
+
+	return costs
+}
+
+// PodCollector exports the hourly cost allocated to the pods and namespaces from the current pricing snapshot.
+type PodCollector struct {
+	nodes     corelisters.NodeLister
+	pods      corelisters.PodLister
+	usage     UsageFunc
+	snapshot  SnapshotFunc
+	keys      labelKeys
+	policy    string
+	podCost   *prometheus.Desc
+	namespace *prometheus.Desc
+}
+
+// NewPodCollector returns a collector watching the nodes and pods with the informer factory.
+// The pods are allocated by requests only when usage is nil.
+func NewPodCollector(factory informers.SharedInformerFactory, usage UsageFunc, snapshot SnapshotFunc, schemas []cloud.LabelSchema, policy string) *PodCollector {
+	return &PodCollector{
+		nodes:    factory.Core().V1().Nodes().Lister(),
+		pods:     factory.Core().V1().Pods().Lister(),
+		usage:    usage,
+		snapshot: snapshot,
+		keys:     newLabelKeys(schemas),
+		policy:   policy,
+		podCost: prometheus.NewDesc(
+			"pod_cost_hourly",
+			"Hourly cost allocated to the pod",
+			[]string{cloud.AccountID, "namespace", "pod", "node"}, nil,
+		),
+		namespace: prometheus.NewDesc(
+			"namespace_cost_hourly",
+			"Hourly cost allocated to the namespace",
+			[]string{cloud.AccountID, "namespace"}, nil,
+		),
+	}
+}
+
+// Costs returns the hourly cost allocated to the pods.
+func (c *PodCollector) Costs(ctx context.Context) ([]PodCost, error) {
+	snapshot := c.snapshot()
+	if snapshot == nil {
+		return []PodCost{}, nil
+	}
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]Resources{}
+	if c.usage != nil {
+		// The requests are still a fair allocation while the metrics API is unavailable.
+		if podUsage, err := c.usage(ctx); err != nil {
+			slog.WarnContext(ctx, "Pod usage unavailable, allocating pod costs by requests", "error", err)
+		} else {
+			usage = podUsage
+		}
+	}
+
+	return allocate(nodes, pods, usage, snapshot, c.keys, c.policy), nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *PodCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.podCost
+	ch <- c.namespace
+}
+
+// Collect implements prometheus.Collector.
+func (c *PodCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), usageTimeout)
+	defer cancel()
+	costs, err := c.Costs(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.podCost, err)
+
+		return
+	}
+
+	type namespace struct{ accountID, name string }
+	namespaces := map[namespace]float64{}
+	for _, cost := range costs {
+		namespaces[namespace{cost.AccountID, cost.Namespace}] += cost.Cost
+		if cost.Pod != "" {
+			ch <- prometheus.MustNewConstMetric(c.podCost, prometheus.GaugeValue, cost.Cost, cost.AccountID, cost.Namespace, cost.Pod, cost.Node)
+		}
+	}
+	for namespace, cost := range namespaces {
+		ch <- prometheus.MustNewConstMetric(c.namespace, prometheus.GaugeValue, cost, namespace.accountID, namespace.name)
+	}
+}
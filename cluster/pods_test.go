@@ -0,0 +1,188 @@
+package cluster
+
+import (
+	"math"
+	"platform-cost-report/cloud"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func resources(cpu, memory string) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+func newPod(namespace, name, node string, requests corev1.ResourceList) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			NodeName:   node,
+			Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Requests: requests}}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func Test_allocate(t *testing.T) {
+	node := newNode("node", map[string]string{
+		"node.kubernetes.io/instance-type": "m5.large",
+		"topology.kubernetes.io/zone":      "eu-west-1a",
+	})
+	node.Status.Capacity = resources("2", "8Gi")
+	node.Status.Allocatable = resources("1900m", "7Gi")
+	pods := []*corev1.Pod{
+		newPod("a", "a-0", "node", resources("1", "2Gi")),
+		newPod("b", "b-0", "node", resources("500m", "1Gi")),
+		newPod("b", "pending", "", resources("1", "1Gi")),
+	}
+	completed := newPod("b", "completed", "node", resources("1", "1Gi"))
+	completed.Status.Phase = corev1.PodSucceeded
+	pods = append(pods, completed)
+	usage := map[string]Resources{"b/b-0": {CPU: 0.25, Memory: 3}}
+	snapshot := &cloud.Snapshot{
+		AccountID: "111",
+		OnDemand:  []*cloud.Price{{InstanceType: "m5.large", CPU: "2", Memory: "8 GiB", Price: 0.1}},
+	}
+	unit := snapshot.OnDemand[0].CalcUnitPrice()
+	costA := 1*unit.CPUPrice + 2*unit.MemPrice
+	costB := 0.5*unit.CPUPrice + 3*unit.MemPrice
+	system := 0.1*unit.CPUPrice + 1*unit.MemPrice
+	idle := 0.1 - system - costA - costB
+
+	tests := []struct {
+		policy string
+		want   map[string]float64
+	}{
+		{
+			policy: cloud.OverheadSeparate,
+			want:   map[string]float64{"a": costA, "b": costB, SystemNamespace: system, IdleNamespace: idle},
+		},
+		{
+			policy: cloud.OverheadProportional,
+			want: map[string]float64{
+				"a": costA + (system+idle)*costA/(costA+costB),
+				"b": costB + (system+idle)*costB/(costA+costB),
+			},
+		},
+		{
+			policy: cloud.OverheadEven,
+			want:   map[string]float64{"a": costA + (system+idle)/2, "b": costB + (system+idle)/2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got := map[string]float64{}
+			total := 0.0
+			for _, cost := range allocate([]*corev1.Node{node}, pods, usage, snapshot, newLabelKeys(nil), tt.policy) {
+				got[cost.Namespace] += cost.Cost
+				total += cost.Cost
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("allocate() = %v, want %v", got, tt.want)
+			}
+			for namespace, want := range tt.want {
+				if math.Abs(got[namespace]-want) > 1e-9 {
+					t.Errorf("allocate() %s = %v, want %v", namespace, got[namespace], want)
+				}
+			}
+			if math.Abs(total-0.1) > 1e-9 {
+				t.Errorf("allocate() total = %v, want node cost 0.1", total)
+			}
+		})
+	}
+}
+
+func Test_allocateOvercommitted(t *testing.T) {
+	node := newNode("node", map[string]string{
+		"node.kubernetes.io/instance-type": "m5.large",
+		"topology.kubernetes.io/zone":      "eu-west-1a",
+	})
+	node.Status.Capacity = resources("2", "8Gi")
+	node.Status.Allocatable = resources("1900m", "7Gi")
+	pods := []*corev1.Pod{
+		newPod("a", "a-0", "node", resources("1", "2Gi")),
+		newPod("b", "b-0", "node", resources("500m", "1Gi")),
+	}
+	usage := map[string]Resources{"a/a-0": {CPU: 2, Memory: 6}, "b/b-0": {CPU: 1, Memory: 4}}
+	snapshot := &cloud.Snapshot{
+		AccountID: "111",
+		OnDemand:  []*cloud.Price{{InstanceType: "m5.large", CPU: "2", Memory: "8 GiB", Price: 0.1}},
+	}
+	unit := snapshot.OnDemand[0].CalcUnitPrice()
+	costA := 2*unit.CPUPrice + 6*unit.MemPrice
+	costB := 1*unit.CPUPrice + 4*unit.MemPrice
+	system := 0.1*unit.CPUPrice + 1*unit.MemPrice
+	scale := (0.1 - system) / (costA + costB)
+
+	for _, policy := range []string{cloud.OverheadSeparate, cloud.OverheadProportional, cloud.OverheadEven} {
+		t.Run(policy, func(t *testing.T) {
+			got := map[string]float64{}
+			total := 0.0
+			for _, cost := range allocate([]*corev1.Node{node}, pods, usage, snapshot, newLabelKeys(nil), policy) {
+				got[cost.Namespace] += cost.Cost
+				total += cost.Cost
+			}
+			if math.Abs(total-0.1) > 1e-9 {
+				t.Errorf("allocate() total = %v, want node cost 0.1", total)
+			}
+			if policy == cloud.OverheadSeparate {
+				want := map[string]float64{"a": costA * scale, "b": costB * scale, SystemNamespace: system, IdleNamespace: 0}
+				for namespace, cost := range want {
+					if math.Abs(got[namespace]-cost) > 1e-9 {
+						t.Errorf("allocate() %s = %v, want %v", namespace, got[namespace], cost)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_podRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want Resources
+	}{
+		{
+			name: "containers",
+			spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Resources: corev1.ResourceRequirements{Requests: resources("500m", "1Gi")}},
+				{Resources: corev1.ResourceRequirements{Requests: resources("250m", "1Gi")}},
+			}},
+			want: Resources{CPU: 0.75, Memory: 2},
+		},
+		{
+			name: "larger init container",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{Resources: corev1.ResourceRequirements{Requests: resources("2", "512Mi")}},
+					{Resources: corev1.ResourceRequirements{Requests: resources("1", "1Gi")}},
+				},
+				Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Requests: resources("500m", "2Gi")}}},
+			},
+			want: Resources{CPU: 2, Memory: 2},
+		},
+		{
+			name: "overhead",
+			spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Resources: corev1.ResourceRequirements{Requests: resources("1", "1Gi")}}},
+				Containers:     []corev1.Container{{Resources: corev1.ResourceRequirements{Requests: resources("500m", "1Gi")}}},
+				Overhead:       resources("250m", "1Gi"),
+			},
+			want: Resources{CPU: 1.25, Memory: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := podRequests(&corev1.Pod{Spec: tt.spec})
+			if math.Abs(got.CPU-tt.want.CPU) > 1e-9 || math.Abs(got.Memory-tt.want.Memory) > 1e-9 {
+				t.Errorf("podRequests() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"platform-cost-report/cloud"
+	"time"
+)
+
+// readiness is the response of the readiness probe.
+type readiness struct {
+	Ready bool `json:"ready"`
+	// Reason explains why the exporter is not ready.
+	Reason             string                           `json:"reason,omitempty"`
+	CollectedAt        *time.Time                       `json:"collectedAt,omitempty"`
+	SnapshotAgeSeconds float64                          `json:"snapshotAgeSeconds,omitempty"`
+	MaxAgeSeconds      float64                          `json:"maxAgeSeconds"`
+	Collectors         map[string]cloud.CollectorStatus `json:"collectors"`
+}
+
+// liveness is the response of the liveness probe.
+type liveness struct {
+	Alive         bool                             `json:"alive"`
+	UptimeSeconds float64                          `json:"uptimeSeconds"`
+	Collectors    map[string]cloud.CollectorStatus `json:"collectors"`
+}
+
+// readyHandler reports ready when a snapshot is loaded and younger than the max age of the config,
+// so the exporter is taken out of the service while its metrics are missing or stale.
+func readyHandler(current *state) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		maxAge := current.cfg.SnapshotAgeLimit()
+		result := readiness{MaxAgeSeconds: maxAge.Seconds(), Collectors: current.health.Collectors()}
+		snapshot, _ := current.get()
+		if snapshot == nil {
+			result.Reason = "no snapshot loaded"
+			writeJSON(rw, http.StatusServiceUnavailable, result)
+
+			return
+		}
+
+		age := time.Since(snapshot.CollectedAt)
+		result.CollectedAt, result.SnapshotAgeSeconds = &snapshot.CollectedAt, age.Seconds()
+		if age > maxAge {
+			result.Reason = "snapshot older than " + maxAge.String()
+			writeJSON(rw, http.StatusServiceUnavailable, result)
+
+			return
+		}
+		result.Ready = true
+		writeJSON(rw, http.StatusOK, result)
+	}
+}
+
+// liveHandler reports the process health, alive as long as it serves the requests whatever the collectors state.
+func liveHandler(current *state, started time.Time) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, liveness{
+			Alive:         true,
+			UptimeSeconds: time.Since(started).Seconds(),
+			Collectors:    current.health.Collectors(),
+		})
+	}
+}
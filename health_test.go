@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"platform-cost-report/cloud"
+	"testing"
+	"time"
+)
+
+func Test_readyHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot *cloud.Snapshot
+		code     int
+		reason   string
+	}{
+		{name: "no snapshot", code: http.StatusServiceUnavailable, reason: "no snapshot loaded"},
+		{name: "stale", snapshot: &cloud.Snapshot{CollectedAt: time.Now().Add(-2 * time.Hour)}, code: http.StatusServiceUnavailable,
+			reason: "snapshot older than 1h0m0s"},
+		{name: "fresh", snapshot: &cloud.Snapshot{CollectedAt: time.Now().Add(-time.Minute)}, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &state{cfg: cloud.Config{SnapshotMaxAge: "1h"}, snapshot: tt.snapshot, health: cloud.NewHealth()}
+			rec := httptest.NewRecorder()
+			readyHandler(current)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.code {
+				t.Errorf("readyHandler() code = %d, want %d", rec.Code, tt.code)
+			}
+			var got readiness
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("readyHandler() body: %v", err)
+			}
+			if got.Ready != (tt.code == http.StatusOK) || got.Reason != tt.reason || got.MaxAgeSeconds != 3600 {
+				t.Errorf("readyHandler() = %+v, want reason %q", got, tt.reason)
+			}
+		})
+	}
+}
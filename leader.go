@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"platform-cost-report/cloud"
+	"platform-cost-report/cluster"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// internalSnapshotPath is the endpoint the followers fetch the snapshot of the leader from.
+const internalSnapshotPath = "/internal/snapshot"
+
+// leader elects with a Kubernetes lease the replica collecting the snapshots from AWS. The identity of a replica
+// is its pod name and the address it serves on, so the followers know where to fetch the snapshot of the leader.
+type leader struct {
+	identity string
+	elected  atomic.Bool
+	mu       sync.RWMutex
+	// leaderID is the identity of the current leader, empty until one is observed.
+	leaderID string
+	client   *http.Client
+	scheme   string
+	auth     authorizer
+}
+
+// newLeader returns the leader election of the replica serving on port, identified with the POD_NAME and POD_IP
+// environment variables.
+func newLeader(cfg cloud.Config, port string, auth authorizer) (*leader, error) {
+	name, ip := os.Getenv("POD_NAME"), os.Getenv("POD_IP")
+	if name == "" || ip == "" {
+		return nil, errors.New("leader election requires the POD_NAME and POD_IP environment variables")
+	}
+	l := &leader{
+		identity: name + "_" + net.JoinHostPort(ip, port),
+		client:   &http.Client{Timeout: time.Minute},
+		scheme:   "http",
+		auth:     auth,
+	}
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := leaderTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		l.scheme = "https"
+		l.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	return l, nil
+}
+
+// leaderTLSConfig returns the TLS config the followers fetch the snapshot of the leader with. The replicas share
+// the certificate, presented to the leader in case it verifies the client certificates. The certificate of the
+// leader is verified with the leader CA bundle, else the client CA bundle, else the system roots, for the leader
+// server name when set since the certificate rarely holds the pod IPs.
+func leaderTLSConfig(cfg cloud.Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   cfg.LeaderTLSServerName,
+		MinVersion:   tls.VersionTLS12,
+	}
+	caFile := cfg.LeaderTLSCAFile
+	if caFile == "" {
+		caFile = cfg.TLSClientCAFile
+	}
+	if caFile != "" {
+		if tlsConfig.RootCAs, err = readCertPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// leading returns whether the replica holds the lease.
+func (l *leader) leading() bool {
+	return l.elected.Load()
+}
+
+// current returns the identity of the current leader.
+func (l *leader) current() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.leaderID
+}
+
+// elect runs the replica for the lease until ctx is canceled. The leader refreshes the snapshot when elected,
+// unless it holds the fresh snapshot of the previous leader. A failed refresh is retried with backoff while leading.
+func elect(ctx context.Context, current *state) {
+	client, err := cluster.NewClient()
+	if err != nil {
+		panic(err)
+	}
+	err = current.leader.run(ctx, current.cfg, client, func(ctx context.Context) {
+		if snapshot, _ := current.get(); snapshot != nil && time.Since(snapshot.CollectedAt) < refreshSchedule {
+			return
+		}
+		// ctx is canceled when the lease is lost, stopping the retries.
+		current.refreshRetrying(ctx, cloud.CollectorLeader)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// run runs for the lease until ctx is canceled, calling elected with a context canceled when the lease is lost.
+// A replica losing the lease runs for it again as a follower.
+func (l *leader) run(ctx context.Context, cfg cloud.Config, client kubernetes.Interface, elected func(context.Context)) error {
+	namespace := cfg.LeaseNamespace
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		return errors.New("leader election requires the lease namespace or the POD_NAMESPACE environment variable")
+	}
+
+	ttl := cfg.LeaseTTL()
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: cfg.LeaseName, Namespace: namespace},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+		},
+		// The ratios of the client-go defaults: 15s, 10s and 2s.
+		LeaseDuration:   ttl,
+		RenewDeadline:   ttl * 2 / 3,
+		RetryPeriod:     ttl * 2 / 15,
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				l.elected.Store(true)
+				slog.InfoContext(ctx, "Started leading", "identity", l.identity)
+				elected(ctx)
+			},
+			OnStoppedLeading: func() {
+				if l.elected.Swap(false) {
+					slog.Info("Stopped leading", "identity", l.identity)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				l.mu.Lock()
+				l.leaderID = identity
+				l.mu.Unlock()
+				slog.Info("New leader", "leader", identity)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("leader election: %w", err)
+	}
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	return nil
+}
+
+// follow fetches the snapshot of the leader every interval while the replica follows, until ctx is canceled.
+func (l *leader) follow(ctx context.Context, current *state, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.sync(ctx, current); err != nil {
+			slog.WarnContext(ctx, "Leader snapshot sync failed", "leader", l.current(), "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync installs the snapshot of the leader when it changed. It does nothing while leading or until a leader is known.
+func (l *leader) sync(ctx context.Context, current *state) error {
+	identity := l.current()
+	if l.leading() || identity == "" || identity == l.identity {
+		return nil
+	}
+	addr, err := leaderAddress(identity)
+	if err != nil {
+		return err
+	}
+	snapshot, _ := current.get()
+	fetched, err := l.fetch(ctx, addr, snapshot)
+	current.health.Record(cloud.CollectorLeader, err)
+	if err != nil || fetched == nil {
+		return err
+	}
+	current.install(ctx, fetched)
+	slog.InfoContext(ctx, "Snapshot fetched from the leader", "leader", identity, "counts", fetched.Counts())
+
+	return nil
+}
+
+// fetch returns the snapshot of the leader serving on addr, nil when it is still the snapshot held.
+func (l *leader) fetch(ctx context.Context, addr string, held *cloud.Snapshot) (*cloud.Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.scheme+"://"+addr+internalSnapshotPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("leader snapshot: %w", err)
+	}
+	if l.auth.token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.auth.token)
+	}
+	if held != nil {
+		req.Header.Set("If-None-Match", snapshotETag(held))
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("leader snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return cloud.ReadSnapshot(resp.Body)
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("leader snapshot: %s", resp.Status)
+	}
+}
+
+// leaderAddress returns the address of the replica of the identity, <pod name>_<IP>:<port>.
+func leaderAddress(identity string) (string, error) {
+	_, addr, ok := strings.Cut(identity, "_")
+	if !ok {
+		return "", fmt.Errorf("invalid leader identity %q", identity)
+	}
+
+	return addr, nil
+}
+
+// snapshotETag returns the entity tag of the snapshot, its collection time.
+func snapshotETag(snapshot *cloud.Snapshot) string {
+	return strconv.Quote(strconv.FormatInt(snapshot.CollectedAt.UnixNano(), 10))
+}
+
+// snapshotHandler serves the snapshot archive to the followers, authorized like the manual refreshes and disabled
+// without token or client CA.
+func snapshotHandler(current *state, auth authorizer) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !auth.enabled() {
+			writeJSONError(rw, http.StatusForbidden, errors.New("snapshot transfer disabled, set refreshTokenFile or tlsClientCAFile"))
+
+			return
+		}
+		if !auth.authorized(r) {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(rw, http.StatusUnauthorized, errors.New("unauthorized"))
+
+			return
+		}
+		snapshot, _ := current.get()
+		if snapshot == nil {
+			writeJSONError(rw, http.StatusServiceUnavailable, errors.New("no snapshot loaded"))
+
+			return
+		}
+
+		etag := snapshotETag(snapshot)
+		rw.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			rw.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+		rw.Header().Set("Content-Type", "application/gzip")
+		if err := cloud.WriteSnapshot(rw, snapshot); err != nil {
+			slog.WarnContext(r.Context(), "Snapshot not served", "error", err)
+		}
+	}
+}
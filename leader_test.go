@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"platform-cost-report/cloud"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_leaderAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		want     string
+		wantErr  bool
+	}{
+		{name: "ipv4", identity: "exporter-0_10.0.0.1:8080", want: "10.0.0.1:8080"},
+		{name: "ipv6", identity: "exporter-0_[fd00::1]:8080", want: "[fd00::1]:8080"},
+		{name: "no address", identity: "exporter-0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := leaderAddress(tt.identity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("leaderAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("leaderAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_snapshotHandler(t *testing.T) {
+	snapshot := &cloud.Snapshot{CollectedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	tests := []struct {
+		name        string
+		auth        authorizer
+		snapshot    *cloud.Snapshot
+		token       string
+		ifNoneMatch string
+		code        int
+	}{
+		{name: "disabled", snapshot: snapshot, token: "secret", code: http.StatusForbidden},
+		{name: "unauthorized", auth: authorizer{token: "secret"}, snapshot: snapshot, token: "other", code: http.StatusUnauthorized},
+		{name: "no snapshot", auth: authorizer{token: "secret"}, token: "secret", code: http.StatusServiceUnavailable},
+		{name: "snapshot", auth: authorizer{token: "secret"}, snapshot: snapshot, token: "secret", code: http.StatusOK},
+		{name: "not modified", auth: authorizer{token: "secret"}, snapshot: snapshot, token: "secret",
+			ifNoneMatch: snapshotETag(snapshot), code: http.StatusNotModified},
+		{name: "modified", auth: authorizer{token: "secret"}, snapshot: snapshot, token: "secret",
+			ifNoneMatch: `"1"`, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, internalSnapshotPath, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			snapshotHandler(&state{snapshot: tt.snapshot}, tt.auth)(rec, req)
+
+			if rec.Code != tt.code {
+				t.Errorf("snapshotHandler() code = %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			if tt.code == http.StatusOK || tt.code == http.StatusNotModified {
+				if got := rec.Header().Get("ETag"); got != snapshotETag(snapshot) {
+					t.Errorf("snapshotHandler() ETag = %q, want %q", got, snapshotETag(snapshot))
+				}
+			}
+		})
+	}
+}
+
+func Test_leader_fetch(t *testing.T) {
+	snapshot := &cloud.Snapshot{CollectedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	auth := authorizer{token: "secret"}
+	server := httptest.NewServer(snapshotHandler(&state{snapshot: snapshot}, auth))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	l := &leader{client: server.Client(), scheme: "http", auth: auth}
+
+	fetched, err := l.fetch(context.Background(), addr, nil)
+	if err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+	if fetched == nil || !fetched.CollectedAt.Equal(snapshot.CollectedAt) {
+		t.Fatalf("fetch() = %v, want the snapshot of the leader", fetched)
+	}
+
+	fetched, err = l.fetch(context.Background(), addr, snapshot)
+	if err != nil || fetched != nil {
+		t.Errorf("fetch() of the held snapshot = %v, %v, want nil", fetched, err)
+	}
+
+	l.auth = authorizer{token: "other"}
+	if _, err := l.fetch(context.Background(), addr, nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("fetch() unauthorized error = %v, want 401", err)
+	}
+}
+
+func Test_leader_fetchTLS(t *testing.T) {
+	snapshot := &cloud.Snapshot{CollectedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	auth := authorizer{token: "secret"}
+	server := httptest.NewTLSServer(snapshotHandler(&state{snapshot: snapshot}, auth))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	// The replicas share the certificate of the test server, valid for example.com, its own CA.
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	key, err := x509.MarshalPKCS8PrivateKey(server.TLS.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	for file, content := range map[string][]byte{
+		certFile: certPEM,
+		keyFile:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}),
+		caFile:   certPEM,
+	} {
+		if err := os.WriteFile(file, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		caFile     string
+		serverName string
+		wantErr    bool
+	}{
+		{name: "leader CA and server name", caFile: caFile, serverName: "example.com"},
+		{name: "other server name", caFile: caFile, serverName: "cost-report.example.org", wantErr: true},
+		{name: "system roots", serverName: "example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cloud.DefaultConfig()
+			cfg.TLSCertFile, cfg.TLSKeyFile = certFile, keyFile
+			cfg.LeaderTLSCAFile, cfg.LeaderTLSServerName = tt.caFile, tt.serverName
+			tlsConfig, err := leaderTLSConfig(cfg)
+			if err != nil {
+				t.Fatalf("leaderTLSConfig() error = %v", err)
+			}
+			l := &leader{client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, scheme: "https", auth: auth}
+
+			fetched, err := l.fetch(context.Background(), addr, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (fetched == nil || !fetched.CollectedAt.Equal(snapshot.CollectedAt)) {
+				t.Errorf("fetch() = %v, want the snapshot of the leader", fetched)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"platform-cost-report/cloud"
+	"time"
+)
+
+// probePaths are the endpoints polled by Kubernetes and Prometheus, logged at the debug level to keep the logs quiet.
+var probePaths = map[string]bool{
+	"/health":  true,
+	"/readyz":  true,
+	"/livez":   true,
+	"/metrics": true,
+}
+
+// newLogger returns the logger writing to w with the level and format of the config.
+func newLogger(cfg cloud.Config, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LoggingLevel()}
+	if cfg.LogFormat == cloud.LogFormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// statusRecorder records the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+// Unwrap returns the response writer, so http.ResponseController reaches its Flush and deadlines.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests logs every request served by next with its status and duration.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if probePaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "HTTP request", "method", r.Method, "path", r.URL.Path, "status", recorder.status,
+			"bytes", recorder.bytes, "duration", time.Since(start), "remote", r.RemoteAddr)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"platform-cost-report/cloud"
+	"strings"
+	"testing"
+)
+
+func Test_newLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantDebug bool
+		wantJSON  bool
+	}{
+		{name: "info json", level: "info", format: cloud.LogFormatJSON, wantJSON: true},
+		{name: "debug json", level: "debug", format: cloud.LogFormatJSON, wantDebug: true, wantJSON: true},
+		{name: "info text", level: "info", format: cloud.LogFormatText},
+		{name: "debug text", level: "debug", format: cloud.LogFormatText, wantDebug: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cloud.DefaultConfig()
+			cfg.LogLevel, cfg.LogFormat = tt.level, tt.format
+			var buf bytes.Buffer
+			logger := newLogger(cfg, &buf)
+			logger.Debug("debug message")
+			logger.Info("info message", "key", "value")
+
+			out := buf.String()
+			if got := strings.Contains(out, "debug message"); got != tt.wantDebug {
+				t.Errorf("newLogger() debug logged = %v, want %v: %s", got, tt.wantDebug, out)
+			}
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			last := lines[len(lines)-1]
+			var entry map[string]interface{}
+			if got := json.Unmarshal([]byte(last), &entry) == nil; got != tt.wantJSON {
+				t.Errorf("newLogger() JSON = %v, want %v: %s", got, tt.wantJSON, last)
+			}
+			if !tt.wantJSON && !strings.Contains(last, "level=INFO") {
+				t.Errorf("newLogger() text line = %s, want key=value pairs", last)
+			}
+		})
+	}
+}
+
+func Test_logRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		handler   http.HandlerFunc
+		wantLevel string
+		status    float64
+		bytes     float64
+	}{
+		{
+			name:      "default status",
+			path:      "/api/v1/recommendations",
+			handler:   func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("[]")) },
+			wantLevel: "INFO", status: http.StatusOK, bytes: 2,
+		},
+		{
+			name: "status",
+			path: "/api/v1/refresh/missing",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusNotFound)
+				rw.Write([]byte("missing"))
+			},
+			wantLevel: "INFO", status: http.StatusNotFound, bytes: 7,
+		},
+		{
+			name:      "probe",
+			path:      "/readyz",
+			handler:   func(rw http.ResponseWriter, r *http.Request) {},
+			wantLevel: "DEBUG", status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cloud.DefaultConfig()
+			cfg.LogLevel = "debug"
+			var buf bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(newLogger(cfg, &buf))
+
+			logRequests(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("logRequests() log = %s: %v", buf.String(), err)
+			}
+			if entry["level"] != tt.wantLevel || entry["path"] != tt.path || entry["status"] != tt.status || entry["bytes"] != tt.bytes {
+				t.Errorf("logRequests() log = %v, want %s status %v and %v bytes", entry, tt.wantLevel, tt.status, tt.bytes)
+			}
+		})
+	}
+}
+
+func Test_logRequests_flush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	logRequests(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(rw).Flush(); err != nil {
+			t.Errorf("Flush() error = %v", err)
+		}
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/refresh", nil))
+
+	if !rec.Flushed {
+		t.Error("logRequests() did not flush the response")
+	}
+}
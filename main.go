@@ -1,63 +1,324 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"platform-cost-report/cloud"
+	"platform-cost-report/cluster"
 	"runtime"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robfig/cron/v3"
+	"k8s.io/client-go/informers"
 )
 
+const (
+	// shutdownTimeout is how long the in-flight HTTP requests and cron jobs are waited for on shutdown.
+	shutdownTimeout = 30 * time.Second
+	// refreshSchedule is the interval of the scheduled refreshes.
+	refreshSchedule = 12 * time.Hour
+	// listenPort is the port the endpoints are served on.
+	listenPort = "8080"
+	// refreshRetryMin and refreshRetryMax bound the exponential backoff of the retries of the first refresh, and of the
+	// refresh of a replica elected leader.
+	refreshRetryMin = 10 * time.Second
+	refreshRetryMax = 10 * time.Minute
+)
+
+// state holds the latest snapshot and the metrics exported from it.
+type state struct {
+	mu       sync.RWMutex
+	cfg      cloud.Config
+	snapshot *cloud.Snapshot
+	reg      prometheus.Gatherer
+	// health records the outcome of the collectors of every refresh.
+	health *cloud.Health
+	// leader elects the replica collecting the snapshots, nil when the leader election is disabled.
+	leader *leader
+}
+
+// follower returns whether another replica collects the snapshots.
+func (s *state) follower() bool {
+	return s.leader != nil && !s.leader.leading()
+}
+
+// refresh collects a new snapshot from AWS, or loads the snapshot file of the config, and replaces the current one
+// on success. The collection is canceled with ctx or after the refresh timeout of the config.
+func (s *state) refresh(ctx context.Context) error {
+	_, err := s.update(ctx)
+
+	return err
+}
+
+// refreshRetrying refreshes the snapshot until it succeeds or ctx is canceled, retrying with an exponential backoff.
+// The failures are logged and recorded in the health of the collector, so the probes report them meanwhile.
+func (s *state) refreshRetrying(ctx context.Context, collector string) {
+	delay := refreshRetryMin
+	for {
+		err := s.refresh(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.health.Record(collector, err)
+		if err == nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Refresh failed", "collector", collector, "retryIn", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, refreshRetryMax)
+	}
+}
+
+// update refreshes the snapshot like refresh and returns the new one.
+func (s *state) update(ctx context.Context) (*cloud.Snapshot, error) {
+	ctx, cancel := context.WithTimeout(cloud.WithHealth(ctx, s.health), s.cfg.RefreshDeadline())
+	defer cancel()
+
+	start := time.Now()
+	var snapshot *cloud.Snapshot
+	var err error
+	if s.cfg.SnapshotFile != "" {
+		snapshot, err = cloud.LoadSnapshot(s.cfg.SnapshotFile)
+		s.health.Record(cloud.CollectorSnapshotFile, err)
+	} else {
+		snapshot, err = cloud.CollectSnapshot(ctx, s.cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.install(ctx, snapshot)
+	slog.InfoContext(ctx, "Snapshot updated", "duration", time.Since(start), "counts", snapshot.Counts())
+
+	return snapshot, nil
+}
+
+// install replaces the current snapshot and its metrics.
+func (s *state) install(ctx context.Context, snapshot *cloud.Snapshot) {
+	reg := snapshot.Gatherer(s.cfg)
+	for _, warning := range snapshot.Warnings {
+		slog.WarnContext(ctx, "Items skipped", "operation", warning.Operation, "count", warning.Skipped, "error", warning.Message)
+	}
+	for _, conflict := range snapshot.PriceConflicts {
+		slog.WarnContext(ctx, "Products with different prices", "instanceType", conflict.InstanceType, "skus", conflict.SKUs,
+			"chosen", conflict.Chosen)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot, s.reg = snapshot, reg
+}
+
+func (s *state) get() (*cloud.Snapshot, prometheus.Gatherer) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.snapshot, s.reg
+}
+
+// watchCluster registers the cluster cost collectors enabled in the config and starts their informers.
+func watchCluster(current *state, reg prometheus.Registerer, stop <-chan struct{}) error {
+	client, err := cluster.NewClient()
+	if err != nil {
+		return err
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	snapshot := func() *cloud.Snapshot {
+		s, _ := current.get()
+
+		return s
+	}
+	if current.cfg.NodeCost {
+		if err := reg.Register(cluster.NewNodeCollector(factory, snapshot, current.cfg.LabelSchemas)); err != nil {
+			return fmt.Errorf("register node collector: %w", err)
+		}
+	}
+	if current.cfg.PodCost {
+		collector := cluster.NewPodCollector(factory, cluster.MetricsAPIUsage(client), snapshot, current.cfg.LabelSchemas, current.cfg.OverheadPolicy)
+		if err := reg.Register(collector); err != nil {
+			return fmt.Errorf("register pod collector: %w", err)
+		}
+	}
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+
+	return nil
+}
+
 func main() {
-	log.Printf("OS: %s\nArchitecture: %s\n", runtime.GOOS, runtime.GOARCH)
+	if len(os.Args) > 1 && os.Args[1] == "recommend" {
+		if err := runRecommend(os.Args[2:]); err != nil {
+			slog.Error("Recommend failed", "error", err)
+			os.Exit(1)
+		}
 
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		if err := runSnapshot(os.Args[2:]); err != nil {
+			slog.Error("Snapshot failed", "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the JSON config file")
+	flag.Parse()
+
+	cfg, err := cloud.LoadConfig(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(newLogger(cfg, os.Stderr))
+	slog.Info("Starting", "os", runtime.GOOS, "arch", runtime.GOARCH)
+
+	// The context is canceled on SIGTERM, canceling the in-flight refreshes.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	started := time.Now()
 	scheduler := cron.New()
 
-	// First exposed metrics on init
-	reg, err := cloud.AWSMetrics()
+	auth, err := newAuthorizer(cfg)
 	if err != nil {
 		panic(err)
 	}
-	_, err = scheduler.AddFunc("@every 12h", func() {
-		reg, err = cloud.AWSMetrics()
-		fmt.Println("AWS metrics updated")
-		if err != nil {
-			fmt.Println("Error: %w", err)
+
+	// First exposed metrics on init, collected while serving so the liveness probe answers meanwhile.
+	// With the leader election, only the leader collects them and the followers fetch its snapshot.
+	current := &state{cfg: cfg, health: cloud.NewHealth()}
+	// released is closed once the lease is released on shutdown.
+	released := make(chan struct{})
+	if cfg.LeaderElection {
+		if current.leader, err = newLeader(cfg, listenPort, auth); err != nil {
+			panic(err)
+		}
+		go func() {
+			defer close(released)
+			elect(ctx, current)
+		}()
+		go current.leader.follow(ctx, current, cfg.LeaderSync())
+	} else {
+		close(released)
+		go current.refreshRetrying(ctx, cloud.CollectorRefresh)
+	}
+	_, err = scheduler.AddFunc(fmt.Sprintf("@every %s", refreshSchedule), func() {
+		if current.follower() {
+			return
+		}
+		if err := current.refresh(ctx); err != nil {
+			slog.ErrorContext(ctx, "Scheduled refresh failed", "error", err)
 		}
 	})
 	if err != nil {
 		panic(err)
 	}
 	scheduler.Start()
+	if cfg.SnapshotFile != "" {
+		go watchSnapshot(ctx, current)
+	}
 
-	http.HandleFunc("/updatePricing", func(writter http.ResponseWriter, reader *http.Request) {
-		reg, err = cloud.AWSMetrics()
-		if err != nil {
-			fmt.Println("Error: %w", err)
-			writter.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(writter, "{\"error\":\"%v\"}", err)
-
-			return
+	clusterReg := prometheus.NewRegistry()
+	clusterReg.MustRegister(cloud.ClientMetrics()...)
+	if cfg.NodeCost || cfg.PodCost {
+		if err = watchCluster(current, clusterReg, ctx.Done()); err != nil {
+			panic(err)
 		}
-		writter.WriteHeader(http.StatusOK)
-		fmt.Fprintf(writter, "{\"message\":\"Pricing updated\"}")
-	})
+	}
+
+	refresh := newRefreshHandler(ctx, current, auth)
+	http.Handle("/updatePricing", refresh)
+	http.HandleFunc("GET /api/v1/refresh", refresh.history)
+	http.HandleFunc("GET /api/v1/refresh/{id}", refresh.status)
 
 	http.HandleFunc("/health", func(rw http.ResponseWriter, r *http.Request) {
 		rw.WriteHeader(http.StatusOK)
 		fmt.Fprintf(rw, "{\"message\":\"OK\"}")
 	})
+	http.HandleFunc("/readyz", readyHandler(current))
+	http.HandleFunc("/livez", liveHandler(current, started))
+	http.HandleFunc("GET "+internalSnapshotPath, snapshotHandler(current, auth))
 
 	http.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
-		handler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+		snapshot, reg := current.get()
+		var gatherer prometheus.Gatherer = clusterReg
+		if snapshot != nil {
+			gatherer = cloud.CurrencyGatherer(prometheus.Gatherers{reg, clusterReg}, snapshot.CurrencyRates)
+		}
+		handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
 		handler.ServeHTTP(rw, r)
 	})
 
-	err = http.ListenAndServe(":8080", nil)
-	if err != nil {
+	http.HandleFunc("/api/v1/recommendations", func(rw http.ResponseWriter, r *http.Request) {
+		snapshot, _ := current.get()
+		if snapshot == nil {
+			writeJSONError(rw, http.StatusServiceUnavailable, errors.New("no snapshot loaded"))
+
+			return
+		}
+		recommendationsHandler(snapshot, rw, r)
+	})
+
+	server := &http.Server{
+		Addr:              ":" + listenPort,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		// The requests keep the background context, so the ones in flight on SIGTERM are drained by Shutdown.
+		Handler:  logRequests(http.DefaultServeMux),
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	if cfg.TLSClientCAFile != "" {
+		if server.TLSConfig, err = clientCATLSConfig(cfg.TLSClientCAFile); err != nil {
+			panic(err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		// A second signal kills the process.
+		stop()
+		slog.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Shutdown failed", "error", err)
+		}
+		select {
+		case <-scheduler.Stop().Done():
+		case <-shutdownCtx.Done():
+			slog.Error("Shutdown failed, cron jobs still running")
+		}
+		select {
+		case <-released:
+		case <-shutdownCtx.Done():
+			slog.Error("Shutdown failed, lease not released")
+		}
+	}()
+
+	if cfg.TLSCertFile != "" {
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
+	<-done
 }
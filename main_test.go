@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"platform-cost-report/cloud"
+	"testing"
+	"time"
+)
+
+func Test_state_refreshRetrying(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cloud.WriteSnapshot(file, &cloud.Snapshot{CollectedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	tests := []struct {
+		name    string
+		file    string
+		success bool
+	}{
+		{name: "loaded", file: path, success: true},
+		{name: "failing", file: filepath.Join(dir, "missing.tar.gz")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &state{cfg: cloud.DefaultConfig(), health: cloud.NewHealth()}
+			current.cfg.SnapshotFile = tt.file
+			// The failing refresh is retried until the context is canceled, instead of crashing the process.
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			current.refreshRetrying(ctx, cloud.CollectorRefresh)
+
+			status := current.health.Collectors()[cloud.CollectorRefresh]
+			snapshot, _ := current.get()
+			if tt.success && (status.LastSuccess == nil || snapshot == nil) {
+				t.Errorf("refreshRetrying() health = %+v, want a success and the snapshot loaded", status)
+			}
+			if !tt.success && (status.LastError == "" || snapshot != nil) {
+				t.Errorf("refreshRetrying() health = %+v, want the error recorded and no snapshot", status)
+			}
+		})
+	}
+}
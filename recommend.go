@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"platform-cost-report/cloud"
+	"strconv"
+	"strings"
+)
+
+// runRecommend collects the pricing data from AWS and prints the spot instance types recommended for the
+// requirements in args.
+func runRecommend(args []string) error {
+	req := cloud.DefaultRequirements()
+	flags := flag.NewFlagSet("recommend", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to the JSON config file")
+	format := flags.String("format", cloud.FormatJSON, "output format: json, karpenter or asg")
+	azs := flags.String("az", "", "comma separated availability zones")
+	flags.IntVar(&req.CPU, "vcpu", req.CPU, "minimum number of vCPUs")
+	flags.IntVar(&req.Memory, "memory", req.Memory, "minimum memory in GiB")
+	flags.IntVar(&req.MaxCPU, "max-vcpu", req.MaxCPU, "maximum number of vCPUs")
+	flags.IntVar(&req.MaxMemory, "max-memory", req.MaxMemory, "maximum memory in GiB")
+	flags.StringVar(&req.Architecture, "arch", req.Architecture, "CPU architecture: arm64 or x86_64")
+	flags.IntVar(&req.Count, "count", req.Count, "number of instance types")
+	flags.IntVar(&req.MaxPerFamily, "max-per-family", req.MaxPerFamily, "maximum number of instance types per family")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *azs != "" {
+		req.AZs = strings.Split(*azs, ",")
+	}
+
+	cfg, err := cloud.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(newLogger(cfg, os.Stderr))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RefreshDeadline())
+	defer cancel()
+	snapshot, err := cloud.CollectSnapshot(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return cloud.WriteRecommendations(os.Stdout, snapshot.Recommend(req), *format)
+}
+
+// requirementsFromQuery reads the workload requirements from the query parameters.
+func requirementsFromQuery(query url.Values) (cloud.Requirements, error) {
+	req := cloud.DefaultRequirements()
+	ints := map[string]*int{
+		"vcpu":           &req.CPU,
+		"memory":         &req.Memory,
+		"max-vcpu":       &req.MaxCPU,
+		"max-memory":     &req.MaxMemory,
+		"count":          &req.Count,
+		"max-per-family": &req.MaxPerFamily,
+	}
+	for name, value := range ints {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return req, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*value = n
+		}
+	}
+	req.Architecture = query.Get("arch")
+	for _, az := range query["az"] {
+		req.AZs = append(req.AZs, strings.Split(az, ",")...)
+	}
+
+	return req, nil
+}
+
+// recommendationsHandler writes the spot instance types recommended for the requirements in the query.
+func recommendationsHandler(snapshot *cloud.Snapshot, rw http.ResponseWriter, r *http.Request) {
+	req, err := requirementsFromQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(rw, http.StatusBadRequest, err)
+
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch format {
+	case cloud.FormatJSON, cloud.FormatASG, "":
+		rw.Header().Set("Content-Type", "application/json")
+	case cloud.FormatKarpenter:
+		rw.Header().Set("Content-Type", "application/yaml")
+	default:
+		writeJSONError(rw, http.StatusBadRequest, fmt.Errorf("unknown format %q", format))
+
+		return
+	}
+	if err := cloud.WriteRecommendations(rw, snapshot.Recommend(req), format); err != nil {
+		slog.WarnContext(r.Context(), "Recommendations not written", "error", err)
+	}
+}
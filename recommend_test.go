@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"platform-cost-report/cloud"
+	"testing"
+)
+
+func Test_recommendationsHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		code        int
+		contentType string
+		wantError   bool
+	}{
+		{name: "json", query: "?vcpu=2", code: http.StatusOK, contentType: "application/json"},
+		{name: "karpenter", query: "?format=karpenter", code: http.StatusOK, contentType: "application/yaml"},
+		{name: "invalid requirement", query: "?vcpu=two", code: http.StatusBadRequest, contentType: "application/json", wantError: true},
+		{name: "unknown format", query: "?format=xml", code: http.StatusBadRequest, contentType: "application/json", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			recommendationsHandler(&cloud.Snapshot{}, rec, httptest.NewRequest(http.MethodGet, "/api/v1/recommendations"+tt.query, nil))
+
+			if rec.Code != tt.code {
+				t.Errorf("recommendationsHandler() code = %d, want %d", rec.Code, tt.code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("recommendationsHandler() Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if tt.wantError {
+				var body map[string]string
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] == "" {
+					t.Errorf("recommendationsHandler() body = %q, want a JSON error: %v", rec.Body.String(), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"platform-cost-report/cloud"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	errRefreshRateLimited = errors.New("refresh rate limited")
+	errNotLeader          = errors.New("not the leader")
+)
+
+// Refresh job states.
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// refreshHistory is the number of refresh jobs kept in memory, the oldest finished ones are dropped first.
+const refreshHistory = 20
+
+// refreshJob is a manual refresh running in the background.
+type refreshJob struct {
+	ID         string                         `json:"id"`
+	State      string                         `json:"state"`
+	StartedAt  time.Time                      `json:"startedAt"`
+	FinishedAt *time.Time                     `json:"finishedAt,omitempty"`
+	Duration   float64                        `json:"durationSeconds"`
+	Progress   map[string]cloud.StageProgress `json:"progress"`
+	// Counts are the items of the snapshot collected by a successful job.
+	Counts map[string]int `json:"counts,omitempty"`
+	Error  string         `json:"error,omitempty"`
+
+	progress *cloud.Progress
+}
+
+// refreshJobs holds the recent refresh jobs, at most one running.
+type refreshJobs struct {
+	mu      sync.Mutex
+	jobs    []*refreshJob
+	running *refreshJob
+}
+
+// view returns a copy of the job safe to encode while it runs. The lock must be held.
+func (j *refreshJob) view() refreshJob {
+	view := *j
+	view.Progress = j.progress.Stages()
+	if j.FinishedAt == nil {
+		view.Duration = time.Since(j.StartedAt).Seconds()
+	}
+
+	return view
+}
+
+// add adds a running job, dropping the oldest finished ones above the history size, and returns its view.
+func (s *refreshJobs) add(job *refreshJob) refreshJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = job
+	s.jobs = append(s.jobs, job)
+	for len(s.jobs) > refreshHistory {
+		s.jobs = s.jobs[1:]
+	}
+
+	return job.view()
+}
+
+// finish records the result of the running job.
+func (s *refreshJobs) finish(job *refreshJob, snapshot *cloud.Snapshot, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Duration = now.Sub(job.StartedAt).Seconds()
+	if err != nil {
+		job.State, job.Error = jobFailed, err.Error()
+	} else {
+		job.State, job.Counts = jobSucceeded, snapshot.Counts()
+	}
+	s.running = nil
+}
+
+// current returns the running job.
+func (s *refreshJobs) current() (refreshJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		return refreshJob{}, false
+	}
+
+	return s.running.view(), true
+}
+
+// get returns the job with the ID.
+func (s *refreshJobs) get(id string) (refreshJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job.view(), true
+		}
+	}
+
+	return refreshJob{}, false
+}
+
+// list returns the jobs, the most recent first.
+func (s *refreshJobs) list() []refreshJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]refreshJob, 0, len(s.jobs))
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		result = append(result, s.jobs[i].view())
+	}
+
+	return result
+}
+
+// refreshHandler serves the manual refreshes: POST only, authorized with a bearer token or a verified client
+// certificate and rate limited. A refresh runs in the background as a job, a request made while a job runs
+// returns that job instead of starting another one.
+type refreshHandler struct {
+	// ctx cancels the jobs on shutdown, they are not canceled with the request that started them.
+	ctx    context.Context
+	update func(context.Context) (*cloud.Snapshot, error)
+	auth   authorizer
+	// leader is nil when the leader election is disabled, the followers do not refresh.
+	leader   *leader
+	limiter  *rate.Limiter
+	interval time.Duration
+	jobs     refreshJobs
+	// mu serializes the job starts, so the rate limit is only checked when no job runs.
+	mu sync.Mutex
+}
+
+// newRefreshHandler returns the refresh handler of the config.
+func newRefreshHandler(ctx context.Context, current *state, auth authorizer) *refreshHandler {
+	return &refreshHandler{
+		ctx:      ctx,
+		update:   current.update,
+		auth:     auth,
+		leader:   current.leader,
+		limiter:  rate.NewLimiter(rate.Every(current.cfg.RefreshInterval()), 1),
+		interval: current.cfg.RefreshInterval(),
+	}
+}
+
+// authorizer authorizes the requests with a bearer token or a client certificate verified by the client CA.
+type authorizer struct {
+	token string
+	mtls  bool
+}
+
+// newAuthorizer returns the authorizer of the config, reading its bearer token file.
+func newAuthorizer(cfg cloud.Config) (authorizer, error) {
+	auth := authorizer{mtls: cfg.TLSClientCAFile != ""}
+	if cfg.RefreshTokenFile != "" {
+		token, err := os.ReadFile(cfg.RefreshTokenFile) // #nosec G304 -- the path comes from the exporter config
+		if err != nil {
+			return auth, fmt.Errorf("read refresh token: %w", err)
+		}
+		auth.token = strings.TrimSpace(string(token))
+		if auth.token == "" {
+			return auth, fmt.Errorf("empty refresh token in %s", cfg.RefreshTokenFile)
+		}
+	}
+
+	return auth, nil
+}
+
+// enabled returns whether a token or a client CA is configured.
+func (a authorizer) enabled() bool {
+	return a.token != "" || a.mtls
+}
+
+// authorized returns whether the request has the bearer token or a client certificate verified by the client CA.
+func (a authorizer) authorized(r *http.Request) bool {
+	if a.mtls && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return ok && a.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// authorize writes the error response and returns false when the request is not authorized.
+func (h *refreshHandler) authorize(rw http.ResponseWriter, r *http.Request) bool {
+	if !h.auth.enabled() {
+		writeJSONError(rw, http.StatusForbidden, errors.New("manual refresh disabled, set refreshTokenFile or tlsClientCAFile"))
+
+		return false
+	}
+	if !h.auth.authorized(r) {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(rw, http.StatusUnauthorized, errors.New("unauthorized"))
+
+		return false
+	}
+
+	return true
+}
+
+// ServeHTTP starts a refresh job and returns it with its status URL.
+func (h *refreshHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		writeJSONError(rw, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+
+		return
+	}
+	if !h.authorize(rw, r) {
+		return
+	}
+
+	job, err := h.start()
+	switch {
+	case errors.Is(err, errNotLeader):
+		writeJSONError(rw, http.StatusConflict, err)
+	case errors.Is(err, errRefreshRateLimited):
+		rw.Header().Set("Retry-After", fmt.Sprint(int(h.interval.Seconds())))
+		writeJSONError(rw, http.StatusTooManyRequests, err)
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Refresh job not started", "error", err)
+		writeJSONError(rw, http.StatusInternalServerError, err)
+	default:
+		rw.Header().Set("Location", "/api/v1/refresh/"+job.ID)
+		writeJSON(rw, http.StatusAccepted, job)
+	}
+}
+
+// start starts a refresh job, or returns the running one.
+func (h *refreshHandler) start() (refreshJob, error) {
+	if h.leader != nil && !h.leader.leading() {
+		return refreshJob{}, fmt.Errorf("%w, refresh on %s", errNotLeader, h.leader.current())
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if job, ok := h.jobs.current(); ok {
+		return job, nil
+	}
+	if !h.limiter.Allow() {
+		return refreshJob{}, errRefreshRateLimited
+	}
+	id, err := newRefreshID()
+	if err != nil {
+		return refreshJob{}, err
+	}
+
+	job := &refreshJob{ID: id, State: jobRunning, StartedAt: time.Now(), progress: cloud.NewProgress()}
+	view := h.jobs.add(job)
+	go func() {
+		snapshot, err := h.update(cloud.WithProgress(h.ctx, job.progress))
+		if err != nil {
+			slog.ErrorContext(h.ctx, "Refresh job failed", "job", id, "error", err)
+		} else {
+			slog.InfoContext(h.ctx, "Refresh job succeeded", "job", id)
+		}
+		h.jobs.finish(job, snapshot, err)
+	}()
+
+	return view, nil
+}
+
+// status returns the refresh job of the ID in the path.
+func (h *refreshHandler) status(rw http.ResponseWriter, r *http.Request) {
+	if !h.authorize(rw, r) {
+		return
+	}
+	job, ok := h.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(rw, http.StatusNotFound, fmt.Errorf("unknown refresh job %q", r.PathValue("id")))
+
+		return
+	}
+	writeJSON(rw, http.StatusOK, job)
+}
+
+// history returns the recent refresh jobs.
+func (h *refreshHandler) history(rw http.ResponseWriter, r *http.Request) {
+	if !h.authorize(rw, r) {
+		return
+	}
+	writeJSON(rw, http.StatusOK, h.jobs.list())
+}
+
+// clientCATLSConfig returns the TLS config verifying the client certificates with the CA bundle when given.
+// They are optional so the other endpoints, e.g. the metrics, are still served without one.
+func clientCATLSConfig(caFile string) (*tls.Config, error) {
+	pool, err := readCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// readCertPool returns the pool of the certificates of the CA bundle.
+func readCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile) // #nosec G304 -- the path comes from the exporter config
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate in CA bundle %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// newRefreshID returns a random refresh ID.
+func newRefreshID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("refresh ID: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// writeJSON writes the value as a JSON body with the status code.
+func writeJSON(rw http.ResponseWriter, code int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v) // #nosec G104 -- the client may be gone
+}
+
+// writeJSONError writes the error as a JSON body with the status code.
+func writeJSONError(rw http.ResponseWriter, code int, err error) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(map[string]string{"error": err.Error()}) // #nosec G104 -- the client may be gone
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"platform-cost-report/cloud"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestRefreshHandler returns a refresh handler allowing a refresh per hour, running update instead of a collection.
+func newTestRefreshHandler(t *testing.T, auth authorizer, update func(context.Context) (*cloud.Snapshot, error)) *refreshHandler {
+	t.Helper()
+	h := newRefreshHandler(context.Background(), &state{cfg: cloud.Config{RefreshMinInterval: "1h"}}, auth)
+	h.update = update
+
+	return h
+}
+
+// waitRefreshJob waits for the running job of the handler to finish.
+func waitRefreshJob(t *testing.T, h *refreshHandler) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := h.jobs.current(); !ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh job still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func postRefresh(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/refresh", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func Test_authorizer_authorized(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	tests := []struct {
+		name   string
+		auth   authorizer
+		header string
+		tls    *tls.ConnectionState
+		want   bool
+	}{
+		{name: "token", auth: authorizer{token: "secret"}, header: "Bearer secret", want: true},
+		{name: "wrong token", auth: authorizer{token: "secret"}, header: "Bearer other"},
+		{name: "no bearer prefix", auth: authorizer{token: "secret"}, header: "secret"},
+		{name: "no header", auth: authorizer{token: "secret"}},
+		{name: "empty token", auth: authorizer{mtls: true}, header: "Bearer "},
+		{name: "verified certificate", auth: authorizer{mtls: true}, tls: verified, want: true},
+		{name: "unverified certificate", auth: authorizer{mtls: true}, tls: &tls.ConnectionState{}},
+		{name: "certificate without client CA", auth: authorizer{token: "secret"}, tls: verified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/refresh", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			req.TLS = tt.tls
+			if got := tt.auth.authorized(req); got != tt.want {
+				t.Errorf("authorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_refreshHandler_authorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   authorizer
+		method string
+		token  string
+		code   int
+	}{
+		{name: "disabled", method: http.MethodPost, token: "secret", code: http.StatusForbidden},
+		{name: "unauthorized", auth: authorizer{token: "secret"}, method: http.MethodPost, token: "other", code: http.StatusUnauthorized},
+		{name: "no token", auth: authorizer{token: "secret"}, method: http.MethodPost, code: http.StatusUnauthorized},
+		{name: "get", auth: authorizer{token: "secret"}, method: http.MethodGet, token: "secret", code: http.StatusMethodNotAllowed},
+		{name: "authorized", auth: authorizer{token: "secret"}, method: http.MethodPost, token: "secret", code: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestRefreshHandler(t, tt.auth, func(context.Context) (*cloud.Snapshot, error) {
+				return &cloud.Snapshot{}, nil
+			})
+			req := httptest.NewRequest(tt.method, "/api/v1/refresh", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			waitRefreshJob(t, h)
+
+			if rec.Code != tt.code {
+				t.Errorf("ServeHTTP() code = %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); (got != "") != (tt.code == http.StatusUnauthorized) {
+				t.Errorf("ServeHTTP() WWW-Authenticate = %q with code %d", got, rec.Code)
+			}
+		})
+	}
+}
+
+func Test_refreshHandler_rateLimited(t *testing.T) {
+	h := newTestRefreshHandler(t, authorizer{token: "secret"}, func(context.Context) (*cloud.Snapshot, error) {
+		return &cloud.Snapshot{}, nil
+	})
+
+	if rec := postRefresh(h, "secret"); rec.Code != http.StatusAccepted {
+		t.Fatalf("first refresh code = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	waitRefreshJob(t, h)
+
+	rec := postRefresh(h, "secret")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second refresh code = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("second refresh Retry-After = %q, want %q", got, "3600")
+	}
+}
+
+func Test_refreshHandler_coalesce(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	h := newTestRefreshHandler(t, authorizer{token: "secret"}, func(context.Context) (*cloud.Snapshot, error) {
+		calls++
+		<-release
+
+		return &cloud.Snapshot{}, nil
+	})
+
+	var first, second refreshJob
+	rec := postRefresh(h, "secret")
+	if err := json.NewDecoder(rec.Body).Decode(&first); err != nil || rec.Code != http.StatusAccepted {
+		t.Fatalf("first refresh code = %d: %v", rec.Code, err)
+	}
+	rec = postRefresh(h, "secret")
+	if err := json.NewDecoder(rec.Body).Decode(&second); err != nil || rec.Code != http.StatusAccepted {
+		t.Fatalf("second refresh code = %d: %v", rec.Code, err)
+	}
+	close(release)
+	waitRefreshJob(t, h)
+
+	if second.ID != first.ID || second.State != jobRunning {
+		t.Errorf("second refresh = %s %s, want the running job %s", second.ID, second.State, first.ID)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/v1/refresh/"+first.ID {
+		t.Errorf("second refresh Location = %q", got)
+	}
+	if calls != 1 {
+		t.Errorf("update calls = %d, want 1", calls)
+	}
+	if job, _ := h.jobs.get(first.ID); job.State != jobSucceeded {
+		t.Errorf("job state = %s, want %s", job.State, jobSucceeded)
+	}
+}
+
+func Test_refreshJobs_add(t *testing.T) {
+	var jobs refreshJobs
+	for i := range refreshHistory + 5 {
+		job := &refreshJob{ID: strconv.Itoa(i), State: jobRunning, StartedAt: time.Now(), progress: cloud.NewProgress()}
+		jobs.add(job)
+		jobs.finish(job, &cloud.Snapshot{}, nil)
+	}
+
+	list := jobs.list()
+	if len(list) != refreshHistory {
+		t.Fatalf("list() = %d jobs, want %d", len(list), refreshHistory)
+	}
+	if list[0].ID != strconv.Itoa(refreshHistory+4) || list[len(list)-1].ID != "5" {
+		t.Errorf("list() = %s...%s, want the most recent jobs first", list[0].ID, list[len(list)-1].ID)
+	}
+	if _, ok := jobs.get("4"); ok {
+		t.Error("get() returned an evicted job")
+	}
+}
+
+func Test_refreshHandler_notLeader(t *testing.T) {
+	h := newTestRefreshHandler(t, authorizer{token: "secret"}, func(context.Context) (*cloud.Snapshot, error) {
+		return &cloud.Snapshot{}, nil
+	})
+	h.leader = &leader{leaderID: "exporter-1_10.0.0.2:8080"}
+
+	if rec := postRefresh(h, "secret"); rec.Code != http.StatusConflict {
+		t.Errorf("follower refresh code = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
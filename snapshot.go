@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"platform-cost-report/cloud"
+	"time"
+)
+
+// snapshotPollInterval is how often the snapshot file served is checked for updates.
+const snapshotPollInterval = 30 * time.Second
+
+// runSnapshot runs the snapshot subcommand in args.
+func runSnapshot(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: cost-report snapshot export [-config file] [-output file]")
+	}
+
+	flags := flag.NewFlagSet("snapshot export", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to the JSON config file")
+	output := flags.String("output", "-", "path of the snapshot archive, - for the standard output")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := cloud.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(newLogger(cfg, os.Stderr))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RefreshDeadline())
+	defer cancel()
+	snapshot, err := cloud.CollectSnapshot(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	return writeSnapshotFile(*output, snapshot)
+}
+
+// writeSnapshotFile writes the snapshot archive to path, replacing it atomically so a watching exporter never
+// reads a partial file.
+func writeSnapshotFile(path string, snapshot *cloud.Snapshot) error {
+	if path == "-" {
+		return cloud.WriteSnapshot(os.Stdout, snapshot)
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp) // #nosec G304 -- the path comes from the command line
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	if err := writeAndClose(file, snapshot); err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func writeAndClose(file io.WriteCloser, snapshot *cloud.Snapshot) error {
+	if err := cloud.WriteSnapshot(file, snapshot); err != nil {
+		file.Close()
+
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// watchSnapshot reloads the snapshot file of the config when its modification time changes, until ctx is canceled.
+func watchSnapshot(ctx context.Context, current *state) {
+	modTime := func() time.Time {
+		info, err := os.Stat(current.cfg.SnapshotFile)
+		if err != nil {
+			return time.Time{}
+		}
+
+		return info.ModTime()
+	}
+	last := modTime()
+	ticker := time.NewTicker(snapshotPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if latest := modTime(); !latest.IsZero() && !latest.Equal(last) {
+				if err := current.refresh(ctx); err != nil {
+					slog.ErrorContext(ctx, "Snapshot reload failed", "path", current.cfg.SnapshotFile, "error", err)
+
+					continue
+				}
+				last = latest
+			}
+		}
+	}
+}
@@ -23,7 +23,44 @@ data "aws_iam_policy_document" "policy" {
     sid       = ""
     effect    = "Allow"
     resources = ["*"] #tfsec:ignore:aws-iam-no-policy-wildcards
-    actions   = ["ec2:Describe*"]
+    actions   = ["ec2:Describe*", "ec2:GetSpotPlacementScores"]
+  }
+
+  statement {
+    sid       = ""
+    effect    = "Allow"
+    resources = ["*"] #tfsec:ignore:aws-iam-no-policy-wildcards
+    actions   = ["ce:GetCostAndUsage"]
+  }
+
+  dynamic "statement" {
+    for_each = length(var.account_role_arns) > 0 ? [1] : []
+    content {
+      sid       = ""
+      effect    = "Allow"
+      resources = var.account_role_arns
+      actions   = ["sts:AssumeRole"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.cur_bucket != "" ? [1] : []
+    content {
+      sid       = ""
+      effect    = "Allow"
+      resources = ["arn:aws:s3:::${var.cur_bucket}"]
+      actions   = ["s3:ListBucket"]
+    }
+  }
+
+  dynamic "statement" {
+    for_each = var.cur_bucket != "" ? [1] : []
+    content {
+      sid       = ""
+      effect    = "Allow"
+      resources = ["arn:aws:s3:::${var.cur_bucket}/*"]
+      actions   = ["s3:GetObject"]
+    }
   }
 }
 resource "aws_iam_policy" "cost_report_policy" {
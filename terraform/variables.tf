@@ -17,3 +17,15 @@ variable "environment_tag" {
   type        = string
   description = "Tag for the environment"
 }
+
+variable "account_role_arns" {
+  type        = list(string)
+  description = "ARNs of the roles assumed in the other accounts"
+  default     = []
+}
+
+variable "cur_bucket" {
+  type        = string
+  description = "Bucket of the Cost and Usage Report files read with curSource"
+  default     = ""
+}